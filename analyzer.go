@@ -1,19 +1,17 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"image/color"
 	"log"
 	"math"
 	"math/rand/v2"
-	"regexp"
 	"robolimited/config"
+	"robolimited/parser"
 	"robolimited/tools"
 	"slices"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -32,32 +30,17 @@ components in this project, both automatically and manually.
 // Extracts time-series sales data from Rolimon's asset URL
 func extractPriceSeries(url string) (*tools.Sales, error) {
 	//Extract raw HTML from item page source
-	html, _ := tools.GetPageSource(url)
-
-	//Find sales data embedded within source using regex search
-	re := regexp.MustCompile(`var\s+sales_data\s*=\s*(\{[\s\S]*?\});`)
-	match := re.FindStringSubmatch(html)
-	if len(match) < 2 {
-		return nil, fmt.Errorf("sales data not found in page HTML")
-	}
-	salesDataJSON := strings.TrimSuffix(match[1], ";")
-
-	//Parse the actual sales data
-	var salesData tools.Sales
-	err := json.Unmarshal([]byte(salesDataJSON), &salesData)
+	html, err := tools.GetPageSource(url)
 	if err != nil {
-		preview := salesDataJSON
-		if len(preview) > 200 {
-			preview = preview[:200] + "..."
-		}
-		return nil, fmt.Errorf("failed to parse sales data JSON: %v\nJSON preview: %s", err, preview)
+		return nil, err
 	}
 
-	return &salesData, nil
+	//Parse and validate sales data embedded within source
+	return parser.Parse(html).Sales()
 }
 
 // Extracts price data, resamples to 1-day snapshots, calculates mean/SD within date range
-func processPriceSeries(id string, daysLower int64, daysUpper int64) (float64, float64, *tools.Sales, []int) {
+func processPriceSeries(id string, daysLower int64, daysUpper int64) (float64, float64, *tools.Sales, []float64) {
 	url := fmt.Sprintf(config.RolimonsSite, id)
 
 	//Pull price data from cache if possible
@@ -65,100 +48,45 @@ func processPriceSeries(id string, daysLower int64, daysUpper int64) (float64, f
 	var err error
 	if tools.SalesData[id] == nil {
 		historyData, err = extractPriceSeries(url)
+		if err != nil && settings.LogConsole {
+			log.Println("Could not extract sales data for", id, ":", err)
+		}
 	}
-
-	dayUnit := int64(24 * 60 * 60) //1 day in seconds
-
-	var pricePoints []int
-	if err != nil {
-		return 0, 0, historyData, pricePoints
+	if err != nil || historyData == nil || len(historyData.Timestamp) == 0 {
+		return 0, 0, historyData, nil
 	}
 
-	// Find segment of time series to consider
-	pricePointsAll := historyData.AvgDailySalesPrice
-	t := historyData.Timestamp
-	var prevTimestamp int64
-	var prevPrice int
-
-	for i := len(pricePointsAll) - 1; i >= 0; i-- {
-		//Only look at sales data within interval [today-daysLower, today-daysUpper]
-		if t[len(t)-1]-t[i] > dayUnit*daysLower {
-			break //Exclude points before (today - daysLower)
-		}
-		if t[len(t)-1]-t[i] < dayUnit*daysUpper {
-			continue //Don't scan points after (today - daysUpper)
-		}
-
-		if prevTimestamp != 0 {
-			timeGap := int64(prevTimestamp) - t[i]
-			//Append intermediary price points if prev_t - t[i] > 1 day
-			if timeGap > dayUnit {
-				priceDiff := prevPrice - pricePointsAll[i]
-				slope := priceDiff / int(timeGap) //slope from i+1 -> i
-				missingDays := int(timeGap / dayUnit)
-				for k := 1; k <= missingDays; k++ {
-					pricePoints = append(pricePoints, int(prevPrice+slope*k*int(dayUnit))) //assume linear
-				}
-				prevTimestamp -= int64(missingDays) * dayUnit
-				prevPrice += slope * missingDays * int(dayUnit)
-			}
-			timeGap = prevTimestamp - t[i]
-			//Skip points if prev_t - t[i] < 1 day
-			if timeGap < dayUnit {
-				prevTimestamp = t[i]
-				prevPrice = pricePointsAll[i]
-				continue
-			}
-		} else {
-			pricePoints = append(pricePoints, pricePointsAll[i])
-			prevTimestamp = t[i]
-			prevPrice = pricePointsAll[i]
+	//Only look at sales data within interval [latest-daysLower, latest-daysUpper]
+	latest := historyData.Timestamp[len(historyData.Timestamp)-1]
+	series, err := tools.Resample(historyData, latest-tools.DayUnit*daysLower, latest-tools.DayUnit*daysUpper, tools.ResampleLinear)
+	if err != nil {
+		if settings.LogConsole {
+			log.Println("Could not resample", id, ":", err)
 		}
+		return 0, 0, historyData, nil
 	}
 
-	// Calculate z-index of point (across past points)
-	mean := 0.0
-	for _, p := range pricePoints {
-		mean += float64(p)
-	}
-	N := float64(len(pricePoints))
-	mean /= N
-
-	std := 0.0
-	for _, p := range pricePoints {
-		std += math.Pow((float64(p) - mean), 2)
-	}
-	std = math.Sqrt(std / (N - 1))
+	mean, std := tools.MeanStdDev(series.Price)
+	return mean, std, historyData, series.Price
+}
 
-	//Reverse price points to be chronological
-	for i, j := 0, len(pricePoints)-1; i < j; i, j = i+1, j-1 {
-		pricePoints[i], pricePoints[j] = pricePoints[j], pricePoints[i]
+// Extracts per-copy ownership data of specific item from Rolimon's asset URL
+func extractCopies(url string) (*parser.Copies, error) {
+	//Extract raw HTML from item page source
+	html, err := tools.GetPageSource(url)
+	if err != nil {
+		return nil, err
 	}
 
-	return mean, std, historyData, pricePoints
+	//Parse and validate ownership data embedded within source
+	return parser.Parse(html).Copies()
 }
 
 // Extracts all owner ids of specific item from Rolimon's asset URL
 func extractOwners(url string) ([]string, error) {
-	//Extract raw HTML from item page source
-	html, _ := tools.GetPageSource(url)
-
-	//Find ownership data embedded within source using regex search
-	re := regexp.MustCompile(`var\s+bc_copies_data\s*=\s*(\{[\s\S]*?\});`)
-	match := re.FindStringSubmatch(html)
-	if len(match) < 2 {
-		return nil, fmt.Errorf("bc_copies_data not found in page HTML")
-	}
-
-	//Parse the JSON
-	jsonStr := strings.TrimSuffix(match[1], ";")
-	var bcData struct {
-		OwnerIDs []int64 `json:"owner_ids"`
-		LastOnline []int64 `json:"bc_last_online"`
-	}
-	err := json.Unmarshal([]byte(jsonStr), &bcData)
+	bcData, err := extractCopies(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse bc_copies_data JSON: %v", err)
+		return nil, err
 	}
 
 	//Sort by most recent active users online
@@ -183,11 +111,46 @@ func extractOwners(url string) ([]string, error) {
 	return owners, nil
 }
 
+// Cache of supply metrics per item (scraped once per run)
+var supplyCache = make(map[string]tools.SupplyMetrics)
+var supplyMu sync.Mutex
+
+// Calculates ownership concentration of an item; pulls from cached metrics if exists
+func findSupply(id string) (tools.SupplyMetrics, error) {
+	supplyMu.Lock()
+	supply, ok := supplyCache[id]
+	supplyMu.Unlock()
+	if ok {
+		return supply, nil
+	}
+
+	bcData, err := extractCopies(fmt.Sprintf(config.RolimonsSite, id))
+	if err != nil {
+		return supply, err
+	}
+	supply = tools.ComputeSupply(bcData.OwnerIDs, bcData.LastOnline, time.Now().Unix())
+
+	supplyMu.Lock()
+	supplyCache[id] = supply
+	supplyMu.Unlock()
+	return supply, nil
+}
+
+// Prints supply metrics of an item, or why they are unavailable
+func printSupply(id string) {
+	supply, err := findSupply(id)
+	if err != nil {
+		fmt.Println("Supply: unavailable |", err)
+		return
+	}
+	fmt.Println("Supply:", supply)
+}
+
 //Calculates z-score of price relative to designated origin
 func findZScoreRelativeTo(id string, price float64, origin float64, logStats bool) float64 {
 	_, std := tools.SalesStats[id].Mean, tools.SalesStats[id].StdDev //Use cache for fast query
 	if std == 0.0 { //Scrape mean and SD if not cached
-		_, std, _, _ = processPriceSeries(id, config.LookbackPeriod, 0) //Get data from lookback period
+		_, std, _, _ = processPriceSeries(id, settings.LookbackPeriod, 0) //Get data from lookback period
 	}
 	z_score := (price - origin) / std
 
@@ -202,7 +165,7 @@ func findZScoreRelativeTo(id string, price float64, origin float64, logStats boo
 func findZScore(id string, price float64, logStats bool) float64 {
 	mean, std := tools.SalesStats[id].Mean, tools.SalesStats[id].StdDev //Use cache for fast query
 	if mean == 0.0 && std == 0.0 { //Scrape mean and SD if not cached
-		mean, std, _, _ = processPriceSeries(id, config.LookbackPeriod, 0) //Get data from lookback period
+		mean, std, _, _ = processPriceSeries(id, settings.LookbackPeriod, 0) //Get data from lookback period
 	}
 	z_score := (price - mean) / std
 
@@ -237,7 +200,7 @@ func modelZScore(id string, daysL1 int64, daysU1 int64, daysL2 int64, daysU2 int
 	//Predict future price using past year's trend
 	curMean, curSD := tools.SalesStats[id].Mean, tools.SalesStats[id].StdDev //Use cache for fast query
 	if curMean == 0.0 && curSD == 0.0 {                                      //Scrape mean and SD if not cached
-		curMean, curSD, _, _ = processPriceSeries(id, config.LookbackPeriod, 0) //Get data from lookback period
+		curMean, curSD, _, _ = processPriceSeries(id, settings.LookbackPeriod, 0) //Get data from lookback period
 	}
 	priceFuture := curMean + z_score*curSD
 
@@ -264,13 +227,7 @@ Returns the forecasted price, residual standard dev. (to examine stability), pea
 */
 
 func modelFourierSTL(id string, daysBefore int64, daysFuture int64, logStats bool) (float64, float64, []int, []int, []float64, []float64) {
-	mean, _, _, pricePoints := processPriceSeries(id, daysBefore, 0)
-
-	//Prepare price series for decomposition
-	priceSeries := make([]float64, len(pricePoints))
-	for i, v := range pricePoints {
-		priceSeries[i] = float64(v)
-	}
+	mean, _, _, priceSeries := processPriceSeries(id, daysBefore, 0)
 	n := len(priceSeries)
 
 	if n < 20 {
@@ -320,7 +277,7 @@ func modelFourierSTL(id string, daysBefore int64, daysFuture int64, logStats boo
 	beta, _ := tools.SolveNormalEq(X, y)
 
 	//Forecast future price average across set period
-	ground := int((time.Now().Unix() - config.SalesDataOrigin) / (24 * 60 * 60)) //Days since data snapshot age
+	ground := int((time.Now().Unix() - settings.SalesDataOrigin) / (24 * 60 * 60)) //Days since data snapshot age
 	horizon := int(daysFuture + int64(ground)) //Adjust for sales data age (predict avg. in [ground, daysFuture + ground])
 
 	if daysFuture <= 0 {
@@ -655,6 +612,8 @@ func modelFourierSTL(id string, daysBefore int64, daysFuture int64, logStats boo
 	*/
 	var peaks_filt []int
 	var dips_filt []int
+	var peak_ratios_filt []float64 //Ratios stay paired with their peak / dip
+	var dip_ratios_filt []float64
 	maxAge := 90 //Ignore adjusted extrema further back than this
 	log.Println(peaks, dips)
 	for i := 0; i < len(peaks); i++ {
@@ -664,6 +623,7 @@ func modelFourierSTL(id string, daysBefore int64, daysFuture int64, logStats boo
 		}
 		if (peaks[i] >= -maxAge) { 
 			peaks_filt = append(peaks_filt, peaks[i])
+			peak_ratios_filt = append(peak_ratios_filt, peak_ratios[i])
 		}
 	}
 	for i := 0; i < len(dips); i++ {
@@ -674,49 +634,49 @@ func modelFourierSTL(id string, daysBefore int64, daysFuture int64, logStats boo
 		
 		if (dips[i] >= -maxAge) {
 			dips_filt = append(dips_filt, dips[i])
+			dip_ratios_filt = append(dip_ratios_filt, dip_ratios[i])
 		}
 	}
-	peaks = peaks_filt
-	dips = dips_filt
-	sort.Ints(peaks_filt)
-	sort.Ints(dips_filt)
+	peaks, peak_ratios = sortExtrema(peaks_filt, peak_ratios_filt)
+	dips, dip_ratios = sortExtrema(dips_filt, dip_ratios_filt)
 
 	return priceFuture, residualSD / mean, peaks, dips, peak_ratios, dip_ratios
 }
 
-// Identify dip to support buy decision with price z-score
-func CheckDip(id string, bestPrice float64, value float64, isDemand bool) bool {
-	if config.LogConsole {
-		fmt.Println("Dip Check | ID:", id)
+// Sorts extrema times ascending, keeping each ratio with its time
+func sortExtrema(times []int, ratios []float64) ([]int, []float64) {
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return times[order[a]] < times[order[b]]
+	})
+	sortedTimes := make([]int, len(times))
+	sortedRatios := make([]float64, len(times))
+	for i, k := range order {
+		sortedTimes[i], sortedRatios[i] = times[k], ratios[k]
 	}
+	return sortedTimes, sortedRatios
+}
 
+// Highest z-score counted as a dip: break-even cutoff, capped by the manipulation upper bound
+func dipCutoff(mean float64, std float64, value float64, isDemand bool, margin float64) float64 {
 	//Different thresholds depending on item demand type
-	threshold := config.DipThresholdND
+	threshold := settings.DipThresholdND
 	if isDemand {
-		threshold = config.DipThresholdD
+		threshold = settings.DipThresholdD
 	}
 
-	//Calculate z-score diff in comparison to break-even score
-	z_score := findZScore(id, bestPrice, config.LogConsole)
-	mean, std := tools.SalesStats[id].Mean, tools.SalesStats[id].StdDev
-
 	worth := mean //Extrinsic value of item (avg. price or value)
 	if value != -1 {
 		worth = value
 	}
 
-	margin := config.MarginND //Discount margin below worth
-	if isDemand {
-		margin = config.MarginD
-	}
-
 	cutoff := (worth*(1-margin)-mean)/std - threshold //z-score below break-even pt
 
-	if config.LogConsole {
-		fmt.Println("Z-Score Cutoff: ", cutoff)
-	}
 	//Margin cutoff + upper bound to protect against price manipulation
-	return z_score <= cutoff && z_score <= config.DipUpperBound
+	return min(cutoff, settings.DipUpperBound)
 }
 
 type Item struct {
@@ -759,8 +719,8 @@ func ForecastWithin(z_low float64, z_high float64, priceLow float64, priceHigh f
 
 		//Filter out items outside price range and demand
 		if priceLow <= price && price <= priceHigh && (!isDemand || demand >= 1) {
-			priceFuture, stability, peaks, dips, p_ratios, d_ratios := modelFourierSTL(id, daysPast, daysFuture, config.LogConsole)
-			z_score := findZScore(id, priceFuture, config.LogConsole)
+			priceFuture, stability, peaks, dips, p_ratios, d_ratios := modelFourierSTL(id, daysPast, daysFuture, settings.LogConsole)
+			z_score := findZScore(id, priceFuture, settings.LogConsole)
 			if z_low <= z_score && z_score <= z_high {
 				nextPeak := -1; nextRatioP := 0.0
 				if (len(peaks) > 0) { nextPeak = peaks[0]; nextRatioP = p_ratios[0]}
@@ -813,6 +773,7 @@ func ForecastWithin(z_low float64, z_high float64, priceLow float64, priceHigh f
 		fmt.Println("Found item:", m.id, "| RAP:", rap, "| Z-Score:", math.Trunc(m.z_score*100)/100, "| Abs. Price Diff:", math.Trunc((m.priceFuture-rap.(float64))*100)/100, "|", name)
 		fmt.Println("Peak:", m.nextPeak, "| Dip:", m.nextDip, "| Stability:", m.stability)
 		fmt.Println("Peak Ratio:", m.nextRatioP, "| Dip Ratio:", m.nextRatioD)
+		printSupply(m.id)
 	}
 
 	return onlyItems
@@ -829,7 +790,7 @@ func SearchItemsWithin(z_low float64, z_high float64, priceLow float64, priceHig
 
 		//Filter out items outside price range and demand
 		if priceLow <= price && price <= priceHigh && (!isDemand || demand >= 1) {
-			z_score := findZScore(id, price, config.LogConsole)
+			z_score := findZScore(id, price, settings.LogConsole)
 			if z_low <= z_score && z_score <= z_high {
 				itemsWithin = append(itemsWithin, Item{id, z_score})
 			}
@@ -845,6 +806,7 @@ func SearchItemsWithin(z_low float64, z_high float64, priceLow float64, priceHig
 		name := itemDetails.Items[m.id][0]
 		onlyItems = append(onlyItems, m.id)
 		fmt.Println("Found item:", m.id, "| Z-Score:", math.Trunc(m.z_score*100)/100, "|", name)
+		printSupply(m.id)
 	}
 
 	return onlyItems
@@ -858,7 +820,11 @@ func SearchFallingItems(z_high float64, priceLow float64, priceHigh float64, isD
 // Looks for item owners within net worth range and construct trade links
 func FindOwners(targetItemId string, worth_low float64, worth_high float64, limit int) {
 	url := fmt.Sprintf(config.RolimonsSite, targetItemId)
-	ownerIds, _ := extractOwners(url)
+	ownerIds, err := extractOwners(url)
+	if err != nil {
+		log.Println("Could not extract owners:", err)
+		return
+	}
 
 	itemDetails := tools.GetLimitedData()
 
@@ -898,7 +864,7 @@ func FindOwners(targetItemId string, worth_low float64, worth_high float64, limi
 
 // Analyzes the z-scores of inventory items and prints list of metrics
 func AnalyzeInventory(forecastPrices bool, forecastType string) {
-	assetIds := tools.GetInventory(fmt.Sprintf("%d", config.RobloxId))
+	assetIds := tools.GetInventory(fmt.Sprintf("%d", settings.RobloxId))
 	itemDetails := tools.GetLimitedData()
 	var tot_z float64      //Total z-score
 	var weighted_z float64 //Weighted z-score
@@ -911,7 +877,7 @@ func AnalyzeInventory(forecastPrices bool, forecastType string) {
 		}
 		name := itemDetails.Items[id][0]
 		rap := itemDetails.Items[id][2].(float64)
-		z_score := findZScore(id, rap, config.LogConsole)
+		z_score := findZScore(id, rap, settings.LogConsole)
 		fmt.Println(name, "| Z-Score:", z_score)
 		tot_z += z_score
 		weighted_z += rap * z_score
@@ -940,7 +906,7 @@ func AnalyzeInventory(forecastPrices bool, forecastType string) {
 			if forecastType == "z_score" {
 				/* DEPRECATED
 				//Examine z-score from 2 months last year compared to its preceding 30 days
-				past_z_score, _ = modelZScore(id, 330, 270, 450, 360, config.LogConsole)
+				past_z_score, _ = modelZScore(id, 330, 270, 450, 360, settings.LogConsole)
 				if past_z_score != past_z_score {
 					continue //Check for NaN
 				}
@@ -956,7 +922,8 @@ func AnalyzeInventory(forecastPrices bool, forecastType string) {
 
 				fmt.Println(name, "|", id, "| Z-Score:", z_score_stl, "| RAP:", rap, "| Price Prediction:", priceSTL)
 				fmt.Println("Peak:", peaks[0], "| Dip:", dips[0], "| Stability: ", stability)
-				fmt.Println("Peak Ratio:", p_ratios[0], "| Dip Ratio:", d_ratios[0], "\n")
+				fmt.Println("Peak Ratio:", p_ratios[0], "| Dip Ratio:", d_ratios[0])
+				fmt.Println()
 			}
 
 			tot_past_z += past_z_score
@@ -1004,7 +971,8 @@ func EvaluateTrade(giveIds []string, receiveIds []string, daysPast int64, daysFu
 	log.Println("____________________________________________________")
 }
 
-func init() {
+// Loads cached sales stats and data, repopulating them if configured
+func loadSalesCache() {
 	//Initialize global sales maps
 	tools.SalesStats = tools.RetrieveSalesStats()
 	tools.SalesData = tools.RetrieveSalesData()
@@ -1012,7 +980,7 @@ func init() {
 	//Precompute mean & standard deviation for past sales data of all items
 	//Write to a .csv file to use for querying later
 	//Make sure to update SalesDataOrigin in settings.go
-	if config.PopulateSalesData {
+	if settings.PopulateSalesData {
 		cycleIncomplete := true //to check if data collection is complete
 
 		for cycleIncomplete {
@@ -1052,7 +1020,7 @@ func init() {
 						mean, SD = tools.SalesStats[id].Mean, tools.SalesStats[id].StdDev
 					} else {
 						//Get data from lookback period
-						mean, SD, historyData, _ = processPriceSeries(itemID, config.LookbackPeriod, 0)
+						mean, SD, historyData, _ = processPriceSeries(itemID, settings.LookbackPeriod, 0)
 						cycleIncomplete = true
 					}
 
@@ -1060,7 +1028,7 @@ func init() {
 						historyData = tools.SalesData[id]
 					} else {
 						if historyData == nil {
-							_, _, historyData, _ = processPriceSeries(itemID, config.LookbackPeriod, 0)
+							_, _, historyData, _ = processPriceSeries(itemID, settings.LookbackPeriod, 0)
 						}
 						cycleIncomplete = true
 					}
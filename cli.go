@@ -4,18 +4,31 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"os"
 	"robolimited/config"
+	"robolimited/notify"
+	"robolimited/parser"
 	"robolimited/tools"
 	"strings"
+	"time"
 )
 
 /*
 Command-line interface to run various modules and operations
 */
 
+/*
+Runtime settings loaded from -config / -profile. The monitor pipeline gets them through
+newPipeline; analysis helpers shared with the CLI modes (forecasts, dip checks, order
+and ledger stores) still read this package-level copy, set once before any mode runs
+and never reassigned.
+*/
+var settings *config.Settings
+
 // Start deal sniper process
 func monitor() {
-	snipeDeals(config.LiveMoney)
+	snipeDeals(settings.LiveMoney)
 }
 
 // Displays player inventory metrics
@@ -30,12 +43,14 @@ func analyzeTrade(giveItems []string, receiveItems []string, daysPast int64, day
 
 // Finds current price-lowering items in market
 func searchDips(threshold float64, priceLow float64, priceHigh float64, isDemand bool) {
-	SearchFallingItems(threshold, priceLow, priceHigh, isDemand)
+	items := SearchFallingItems(threshold, priceLow, priceHigh, isDemand)
+	notifier.Notify(notify.SearchResults("searchDips", items))
 }
 
 // Forecast growth potential with z-score analysis
 func searchForecast(priceLow float64, priceHigh float64, daysPast int64, daysFuture int64, isDemand bool, sortBy string) {
-	ForecastWithin(-1000, 1000, priceLow, priceHigh, daysPast, daysFuture, isDemand, sortBy)
+	items := ForecastWithin(-1000, 1000, priceLow, priceHigh, daysPast, daysFuture, isDemand, sortBy)
+	notifier.Notify(notify.SearchResults("searchForecast", items))
 }
 
 // Scan for item owners within net worth range
@@ -66,12 +81,111 @@ func forecast(forecastItems []string, daysPast int64, daysFuture int64) {
 		log.Println("Dips:", dips)
 		log.Println("Peak Ratios:", p_ratios)
 		log.Println("Dip Ratios:", d_ratios)
+		printSupply(id)
+	}
+}
+
+// Displays reseller order book of an item
+func book(itemId string, limit int) {
+	collectibleItemId, err := tools.GetCollectibleId(itemId)
+	if err != nil {
+		fmt.Println("Could not resolve collectible id:", err)
+		return
+	}
+	sellers, err := tools.GetResellers(collectibleItemId)
+	if err != nil {
+		fmt.Println("Could not get reseller data:", err)
+		return
+	}
+	if len(sellers) == 0 {
+		fmt.Println("No available sellers found.")
+		return
+	}
+	orderBook := tools.BuildOrderBook(sellers)
+
+	//Serial premiums as last fitted by the monitor; book only reads the model file
+
+	fmt.Println("____________________________________________________")
+	fmt.Println(orderBook)
+	fmt.Println("Depth:")
+	for i, level := range orderBook.Levels {
+		if i >= limit {
+			break
+		}
+		fmt.Println("  Price:", level.Price, "| Count:", level.Count, "| Cumulative:", level.Cumulative)
+	}
+	fmt.Println("Serials:")
+	for _, bucket := range orderBook.Serials {
+		fmt.Println("  "+bucket.Label+":", bucket.Count)
+	}
+	fmt.Println("Listings:")
+	for i, l := range orderBook.Listings {
+		if i >= limit {
+			break
+		}
+		premium := serialModel.Premium(l.SerialNumber)
+		fmt.Println("  Price:", l.Price, "| Serial: #", l.SerialNumber, "|", tools.ClassifySerial(l.SerialNumber), "| Adj. Price:", math.Round(float64(l.Price)/premium))
+	}
+	if best, ok := serialModel.SelectListing(orderBook, settings.SerialSearchDepth, math.MaxInt); ok {
+		fmt.Println("Best Value Listing: #", best.SerialNumber, "for", best.Price)
+	} else {
+		fmt.Println("Best Value Listing: none within the cheapest", settings.SerialSearchDepth, "listings")
+	}
+	fmt.Println("____________________________________________________")
+}
+
+// Validates item page parsers against a saved page, and the live page if an item is given
+func checkParsers(pageFile string, itemId string) {
+	report := func(source string, page *parser.ItemPage) bool {
+		fmt.Println("____________________________________________________")
+		fmt.Println("Source:", source)
+		fmt.Println("Variables:", strings.Join(page.Names(), ", "))
+		if len(page.Invalid) > 0 {
+			fmt.Println("Non-JSON variables:", strings.Join(page.Invalid, ", "))
+		}
+		if sales, err := page.Sales(); err == nil {
+			fmt.Println("Sales points:", len(sales.Timestamp))
+		}
+		if copies, err := page.Copies(); err == nil {
+			fmt.Println("Supply:", tools.ComputeSupply(copies.OwnerIDs, copies.LastOnline, time.Now().Unix()))
+		}
+		errs := page.Validate()
+		for _, err := range errs {
+			fmt.Println("FORMAT ERROR:", err)
+		}
+		return len(errs) == 0
+	}
+
+	ok := true
+	html, err := os.ReadFile(pageFile)
+	if err != nil {
+		fmt.Println("Could not read saved page:", err)
+		ok = false
+	} else {
+		ok = report(pageFile, parser.Parse(string(html))) && ok
+	}
+
+	if itemId != "" {
+		page, err := parser.FetchItemPage(itemId)
+		if err != nil {
+			fmt.Println("Could not fetch live page:", err)
+			ok = false
+		} else {
+			ok = report(fmt.Sprintf(config.RolimonsSite, itemId), page) && ok
+		}
+	}
+
+	fmt.Println("____________________________________________________")
+	if !ok {
+		fmt.Println("Parser check FAILED")
+		os.Exit(1)
 	}
+	fmt.Println("Parser check passed")
 }
 
 func main() {
 	// Define the main mode flag
-	mode := flag.String("mode", "", "Which function to run: monitor, analyzeInventory, analyzeTrade, searchDips, searchForecast, forecast, executor")
+	mode := flag.String("mode", "", "Which function to run: monitor, analyzeInventory, analyzeTrade, searchDips, searchForecast, forecast, book, checkParsers, checkNotifiers, orders, latency, watch, exits, portfolio, executor")
 
 	// Flags for analyzeTrade
 	give := flag.String("give", "", "Comma-separated list of items to give")
@@ -94,8 +208,60 @@ func main() {
 	daysPast := flag.Int64("daysPast", 365*5, "Number of past days of historical data to include in the forecast")
 	daysFuture := flag.Int64("daysFuture", 30, "Number of days forward to project avg. price")
 
+	// Flags for latency
+	outcome := flag.String("outcome", "", "Only include traces with this outcome (skip, simulated, missed, unchecked, duplicate, bought, failed, max_lots, halted, shutdown)")
+
+	// Flags for watch
+	targets := flag.String("targets", "", "Watch targets file (defaults to watch_targets_file)")
+
+	// Flags for portfolio
+	importFile := flag.String("import", "", "CSV of acquisitions and disposals to add to the ledger (action,item,price,date[,uaid])")
+
+	// Flags for checkParsers
+	pageFile := flag.String("page", "data/fixtures/rolimons_item.html", "Saved item page to validate parsers against")
+
+	// Flags for runtime settings
+	configFile := flag.String("config", "", "Settings file (defaults to "+config.DefaultSettingsFile+" if present)")
+	profile := flag.String("profile", "", "Settings profile to apply, e.g. paper or conservative")
+	statusAddr := flag.String("status", "", "Serve the status page on this address while monitoring, e.g. 127.0.0.1:8080")
+
 	flag.Parse()
 
+	// Load settings before anything touches files or the network
+	var err error
+	settings, err = config.Load(*configFile, *profile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *statusAddr != "" {
+		settings.StatusAddr = *statusAddr
+		if err := settings.Validate(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if settings.Profile != "" {
+		log.Println("Using settings profile:", settings.Profile)
+	}
+	tools.Configure(settings)
+	initNotifier()
+	defer notifier.Close()
+	if *mode != "watch" { //Watch mode never touches purchase state
+		if err := initSniper(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	//Only modes that reconcile holdings or report cost basis need the ledger
+	if *mode == "exits" || *mode == "portfolio" || (*mode == "monitor" && settings.LiveMoney) {
+		if err := loadLedger(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	loadSalesCache()
+
 	switch *mode {
 	case "monitor":
 		monitor()
@@ -133,6 +299,40 @@ func main() {
 		forecastItems := strings.Split(*items, ",")
 		forecast(forecastItems, *daysPast, *daysFuture)
 
+	case "book":
+		if *itemId == "" {
+			fmt.Println("Please provide a target item id")
+			return
+		}
+		book(*itemId, *limit)
+
+	case "orders":
+		showOrders(*itemId, *limit)
+
+	case "latency":
+		showLatency(*itemId, *outcome)
+
+	case "exits":
+		showExits(*limit, *daysPast)
+
+	case "portfolio":
+		showPortfolio(*importFile, *daysPast, *daysFuture, *limit)
+
+	case "watch":
+		if *targets == "" {
+			*targets = settings.WatchTargetsFile
+		}
+		if err := watch(*targets, *daysPast, *daysFuture); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+	case "checkParsers":
+		checkParsers(*pageFile, *itemId)
+
+	case "checkNotifiers":
+		checkNotifiers()
+
 	default:
 		fmt.Println("Unknown mode:", *mode)
 	}
@@ -11,6 +11,7 @@ const (
 	RolimonsSite           = "https://www.rolimons.com/item/%s"
 	RolimonsDeals          = "https://api.rolimons.com/market/v1/dealactivity"
 	InventoryAPI           = "https://inventory.roblox.com/v1/users/%s/assets/collectibles?limit=100&sortOrder=Asc"
+	AuthenticatedUserAPI   = "https://users.roblox.com/v1/users/authenticated"
 	
 	//Redacted for privacy, security, and ToS
 	PurchaseAPI = "url-to-purchase-endpoint"
@@ -18,68 +19,22 @@ const (
 	ResellerAPI = "url-to-reseller-endpoint"
 	
 
-	//Evaluation Filters
-	PriceRangeLow  = 0 //Price range of limiteds to consider
-	PriceRangeHigh = 400
+	//Runtime tunables (margins, ranges, throttles, data files) are loaded
+	//from config/settings.yaml, see settings.example.yaml
+	//The .ROBLOSECURITY cookie is loaded from ROBOLIMITED_COOKIE or cookie_file
 
-	RAPRangeLow  = 0 //RAP range of limiteds to consider
-	RAPRangeHigh = 1000000
-
-	//Operation Modes
-	LiveMoney = true //Run with real money (true) or simulated costs (false)
-
-	//Data Caching (back up old file!)
-	PopulateSalesData = false //Updates all sales data (KEEP FALSE UNLESS UPDATE NEEDED, TAKES A LONG TIME)
-	SalesDataOrigin = 1762867200 //Unix timestamp of last scrape (update every data collection)
-
-	//Purchase Margins
-	MarginD  = 0.25 //Demand: margin below RAP/Value to buy
-	MarginND = 0.30 //Non-demand: margin below RAP/Value to buy
-
-	//Statistical Z-score settings
-	DipThresholdND = 0.5 //-SD from break even point to consider a dip in price
-	DipThresholdD  = 0.25 //-SD from break even point for demand item
-	DipUpperBound  = -0.5 //Z-score must be below bound to be considered outlier
-
-	LookbackPeriod = 90 //Past number of days to consider for trend analysis
-
-	//Iteration Cycles
-	RefreshRate     = 1000    //Re-extract RAP / Value off Rolimon's API after this many rounds
-	TotalIterations = 1000000 //Amount of cycles to run
-
-	//Scheduling & Throttling
-	MonitorThrottle = 1000 //Milliseconds to yield per monitor update
-	ClockOffset     = 0    //Offset from time.Now() for staggered scheduling across devices
-	MinThrottle     = 250  //Minimum ms to yield before next timemark
-	
 	//Roblox pages
 	RobloxCatalogBaseURL = "https://www.roblox.com/catalog/"
 	RobloxHome           = "https://www.roblox.com/home"
 	PlayerTrade          = "https://www.roblox.com/users/%s/trade"
 
-	//Data Files
-	ActionLogFile  = "data/actions.log" //Log of all buy actions
-	ConsoleLogFile = "data/console.log" //Log of terminal output
-	SalesStatsFile  = "data/sales_stats.csv"   //Mean & SD of past sales data of all items
-	SalesDataFile = "data/sales_data.json" //Raw time-series sales data of all times
-
 	//CSS Selectors
 	PriceSelector         = "span.text-robux-lg"                                           //Best Price
 	BuyButtonSelector     = "button.shopping-cart-buy-button.btn-growth-lg.PurchaseButton" //Buy Button
 	ConfirmButtonSelector = "button.modal-button.btn-primary-md.btn-min-width"             //Confirm Button
 
-	//Private Cookies
-	RobloxCookie = ""
-	RobloxId = 132153132
-
 	//Web Agents
 	UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36"
-	ProxyFile = "web/proxies.txt" //Stores IP credentials and proxy ports
-	AgentsFile = "web/agents.txt" //Stores different user agents for requests
-	RotateProxies = false //Use cycled proxies during deal requests
 
-	
-	//Logging
-	LogConsole = false //Toggle print for processes & stats during execution
 )
 */
\ No newline at end of file
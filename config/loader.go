@@ -0,0 +1,543 @@
+package config
+
+/*
+Loads runtime settings from a YAML file on top of built-in defaults, applies a named
+profile and ROBOLIMITED_* environment overrides, then validates the result.
+Endpoints, selectors and credentials stay in settings.go; everything tunable lives here.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"robolimited/notify"
+	"robolimited/rules"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default location of the runtime settings file
+const DefaultSettingsFile = "config/settings.yaml"
+
+// Prefix of environment variables overriding settings (e.g. ROBOLIMITED_MARGIN_D)
+const EnvPrefix = "ROBOLIMITED_"
+
+// Runtime settings
+type Settings struct {
+	//Evaluation Filters
+	PriceRangeLow  int `yaml:"price_range_low"` //Price range of limiteds to consider
+	PriceRangeHigh int `yaml:"price_range_high"`
+	RAPRangeLow    int `yaml:"rap_range_low"` //RAP range of limiteds to consider
+	RAPRangeHigh   int `yaml:"rap_range_high"`
+
+	//Operation Modes
+	LiveMoney   bool     `yaml:"live_money"`   //Run with real money (true) or simulated costs (false)
+	Strategies  []string `yaml:"strategies"`   //Buy strategies run side by side (first one trades live)
+	ShadowFills bool     `yaml:"shadow_fills"` //Check paper buys against live listings and only book those that would have filled
+	PaperExits  bool     `yaml:"paper_exits"`  //Sell simulated lots by their exit plan while monitoring (paper trading only)
+
+	//Exit Planning
+	ExitHoldDays float64 `yaml:"exit_hold_days"` //Days a bought item must be held before it can be resold
+	ExitWindow   int     `yaml:"exit_window"`    //Days a sell window stays open
+	ExitHorizon  int     `yaml:"exit_horizon"`   //Days ahead to look for a forecast peak
+
+	//Buy Rules (used by the "rules" strategy; first matching rule decides)
+	BuyRules []rules.Rule `yaml:"buy_rules"`
+
+	//Data Caching (back up old file!)
+	PopulateSalesData bool  `yaml:"populate_sales_data"` //Updates all sales data (TAKES A LONG TIME)
+	SalesDataOrigin   int64 `yaml:"sales_data_origin"`   //Unix timestamp of last scrape
+
+	//Purchase Margins
+	MarginD           float64 `yaml:"margin_d"`            //Demand: margin below RAP/Value to buy
+	MarginND          float64 `yaml:"margin_nd"`           //Non-demand: margin below RAP/Value to buy
+	MinResaleGap      float64 `yaml:"min_resale_gap"`      //Min. gap from the listing bought to the next one (0 = off)
+	SerialSearchDepth int     `yaml:"serial_search_depth"` //Cheapest listings to compare by serial-adjusted price
+	RebuyCooldown     int64   `yaml:"rebuy_cooldown"`      //Seconds before the same item may be bought again
+	MaxDealAge        int64   `yaml:"max_deal_age"`        //Seconds after its activity a deal may still be bought live
+
+	//Order Reconciliation
+	ReconcileInterval int64 `yaml:"reconcile_interval"` //Seconds between inventory checks of open orders
+	OrderTimeout      int64 `yaml:"order_timeout"`      //Seconds before an unconfirmed order becomes unknown (failed after twice this)
+
+	//Statistical Z-score settings
+	DipThresholdND float64 `yaml:"dip_threshold_nd"` //-SD from break even point to consider a dip in price
+	DipThresholdD  float64 `yaml:"dip_threshold_d"`  //-SD from break even point for demand item
+	DipUpperBound  float64 `yaml:"dip_upper_bound"`  //Z-score must be below bound to be considered outlier
+	LookbackPeriod int64   `yaml:"lookback_period"`  //Past number of days to consider for trend analysis
+
+	//Supply Concentration
+	RejectConcentrated bool    `yaml:"reject_concentrated"` //Reject dips on items hoarded by few owners
+	MaxOwnerHHI        float64 `yaml:"max_owner_hhi"`       //Herfindahl index above which supply is concentrated
+	MaxTop1Share       float64 `yaml:"max_top1_share"`      //Largest owner's share above which supply is concentrated
+
+	//Iteration Cycles
+	RefreshRate     int `yaml:"refresh_rate"`     //Re-extract RAP / Value after this many rounds
+	TotalIterations int `yaml:"total_iterations"` //Amount of cycles to run
+
+	//Monitor Pipeline
+	ActivityTTL       int `yaml:"activity_ttl"`        //Seconds after its timestamp a deal activity is handled (once)
+	DecisionWorkers   int `yaml:"decision_workers"`    //Deals evaluated in parallel
+	DealQueueSize     int `yaml:"deal_queue_size"`     //Deals waiting for a decider (extra deals are dropped)
+	OrderQueueSize    int `yaml:"order_queue_size"`    //Buys waiting for the executor (deciders wait when full)
+	StatsFetchWorkers int `yaml:"stats_fetch_workers"` //Background fetches of sales stats missing from the cache
+
+	//Scheduling & Throttling
+	MonitorThrottle int64 `yaml:"monitor_throttle"` //Milliseconds to yield per monitor update
+	ClockOffset     int64 `yaml:"clock_offset"`     //Offset from time.Now() for staggered scheduling
+	MinThrottle     int64 `yaml:"min_throttle"`     //Minimum ms to yield before next timemark
+
+	//Data Files
+	ActionLogFile        string `yaml:"action_log_file"`        //Log of all buy actions
+	ConsoleLogFile       string `yaml:"console_log_file"`       //Log of terminal output
+	SalesStatsFile       string `yaml:"sales_stats_file"`       //Mean & SD of past sales data of all items
+	SalesDataFile        string `yaml:"sales_data_file"`        //Raw time-series sales data of all items
+	SerialModelFile      string `yaml:"serial_model_file"`      //Fitted serial number premiums
+	WatchlistFile        string `yaml:"watchlist_file"`         //Per-item watchlist / blocklist, reloaded on change
+	WatchTargetsFile     string `yaml:"watch_targets_file"`     //Alert targets for -mode=watch
+	PurchaseRegistryFile string `yaml:"purchase_registry_file"` //Recent purchases, guards against duplicates
+	OrdersFile           string `yaml:"orders_file"`            //Purchase order history and states
+	CollectibleCacheFile string `yaml:"collectible_cache_file"` //Asset id -> collectible/product id, resolved once
+	TraceFile            string `yaml:"trace_file"`             //Per-deal latency traces (JSON lines)
+	ShadowFile           string `yaml:"shadow_file"`            //Shadow checks of paper buys (JSON lines)
+	LedgerFile           string `yaml:"ledger_file"`            //Real acquisitions with cost basis and disposals
+	PortfolioHistoryFile string `yaml:"portfolio_history_file"` //Portfolio valuations per run (JSON lines)
+
+	//Account
+	RobloxId   int64  `yaml:"roblox_id"`
+	CookieFile string `yaml:"cookie_file"`  //Permission-checked file holding the .ROBLOSECURITY cookie
+	CSRFMaxAge int64  `yaml:"csrf_max_age"` //Seconds before the X-CSRF token is refreshed ahead of a purchase
+	Cookie     Secret `yaml:"-"`            //Loaded from ROBOLIMITED_COOKIE or CookieFile
+
+	//Web Agents
+	ProxyFile     string `yaml:"proxy_file"`     //Stores IP credentials and proxy ports
+	AgentsFile    string `yaml:"agents_file"`    //Stores different user agents for requests
+	RotateProxies bool   `yaml:"rotate_proxies"` //Use cycled proxies during deal requests
+
+	//Logging
+	LogConsole bool `yaml:"log_console"` //Toggle print for processes & stats during execution
+
+	//Monitoring
+	MetricsAddr     string `yaml:"metrics_addr"`      //Address serving /metrics while monitoring, e.g. 127.0.0.1:9100 (empty = off)
+	StatusAddr      string `yaml:"status_addr"`       //Address serving the status page and API while monitoring (empty = off)
+	StatusTokenFile string `yaml:"status_token_file"` //Token for status actions (pause, resume, kill), generated if missing
+
+	//Notifications (purchases, failures, session expiry, search results)
+	Notifications []notify.SinkConfig `yaml:"notifications"`
+
+	Profile string `yaml:"-"` //Name of applied profile
+}
+
+// Settings used when no file or override sets a value
+func Defaults() Settings {
+	return Settings{
+		PriceRangeLow:  0,
+		PriceRangeHigh: 400,
+		RAPRangeLow:    0,
+		RAPRangeHigh:   1000000,
+
+		LiveMoney:  false,
+		Strategies: []string{"margin-zscore"},
+
+		ExitHoldDays: 0,
+		ExitWindow:   7,
+		ExitHorizon:  30,
+
+		PopulateSalesData: false,
+		SalesDataOrigin:   1762867200,
+
+		MarginD:           0.25,
+		MarginND:          0.30,
+		MinResaleGap:      0.0,
+		SerialSearchDepth: 5,
+		RebuyCooldown:     3600,
+		MaxDealAge:        30,
+
+		ReconcileInterval: 60,
+		OrderTimeout:      600,
+
+		DipThresholdND: 0.5,
+		DipThresholdD:  0.25,
+		DipUpperBound:  -0.5,
+		LookbackPeriod: 90,
+
+		RejectConcentrated: false,
+		MaxOwnerHHI:        0.10,
+		MaxTop1Share:       0.20,
+
+		RefreshRate:     1000,
+		TotalIterations: 1000000,
+
+		ActivityTTL:       600,
+		DecisionWorkers:   4,
+		DealQueueSize:     64,
+		OrderQueueSize:    16,
+		StatsFetchWorkers: 2,
+
+		MonitorThrottle: 1000,
+		ClockOffset:     0,
+		MinThrottle:     250,
+
+		ActionLogFile:        "data/actions.log",
+		ConsoleLogFile:       "data/console.log",
+		SalesStatsFile:       "data/sales_stats.csv",
+		SalesDataFile:        "data/sales_data.json",
+		SerialModelFile:      "data/serial_model.json",
+		WatchlistFile:        "config/watchlist.yaml",
+		WatchTargetsFile:     "config/targets.yaml",
+		PurchaseRegistryFile: "data/purchases.json",
+		OrdersFile:           "data/orders.json",
+		CollectibleCacheFile: "data/collectibles.json",
+		TraceFile:            "data/traces.jsonl",
+		ShadowFile:           "data/shadow.jsonl",
+		LedgerFile:           "data/ledger.json",
+		PortfolioHistoryFile: "data/portfolio_history.jsonl",
+
+		CookieFile: "config/roblosecurity",
+		CSRFMaxAge: 1800,
+
+		ProxyFile:     "web/proxies.txt",
+		AgentsFile:    "web/agents.txt",
+		RotateProxies: false,
+
+		LogConsole: false,
+
+		StatusTokenFile: "config/status_token",
+	}
+}
+
+// Built-in profiles, applied over the file's base settings (file profiles of the same name win)
+var builtinProfiles = map[string]func(s *Settings){
+	//Simulated trading only
+	"paper": func(s *Settings) {
+		s.LiveMoney = false
+	},
+	//Wider margins and manipulation guards (leaves live_money as set)
+	"conservative": func(s *Settings) {
+		s.MarginD = 0.35
+		s.MarginND = 0.40
+		s.MinResaleGap = 0.10
+		s.DipUpperBound = -1.0
+		s.RejectConcentrated = true
+	},
+	//Live trading with the base settings
+	"live": func(s *Settings) {
+		s.LiveMoney = true
+	},
+}
+
+// Layout of the settings file: base settings, a default profile and named profile overlays
+type settingsFile struct {
+	Profile  string               `yaml:"profile"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+/*
+Loads settings from path and applies profile and environment overrides.
+
+An empty path falls back to DefaultSettingsFile if it exists, otherwise defaults only.
+An empty profile falls back to ROBOLIMITED_PROFILE, then the file's "profile" key.
+*/
+func Load(path string, profile string) (*Settings, error) {
+	s := Defaults()
+
+	explicit := path != ""
+	if !explicit {
+		path = DefaultSettingsFile
+	}
+
+	var file settingsFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("reading settings: %w", err)
+		}
+	} else {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if len(doc.Content) > 0 {
+			if err := doc.Content[0].Decode(&file); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", path, err)
+			}
+			if err := decodeStrict(doc.Content[0], &s); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", path, err)
+			}
+		}
+	}
+
+	//Pick and apply profile
+	if profile == "" {
+		profile = os.Getenv(EnvPrefix + "PROFILE")
+	}
+	if profile == "" {
+		profile = file.Profile
+	}
+	if profile != "" {
+		if err := applyProfile(&s, profile, file.Profiles); err != nil {
+			return nil, err
+		}
+		s.Profile = profile
+	}
+
+	if err := applyEnv(&s); err != nil {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	//Credentials come last so they never pass through settings files
+	s.Cookie, err = LoadSecret(CookieEnv, s.CookieFile)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Applies a built-in and/or file profile over settings
+func applyProfile(s *Settings, name string, fileProfiles map[string]yaml.Node) error {
+	builtin, isBuiltin := builtinProfiles[name]
+	node, inFile := fileProfiles[name]
+	if !isBuiltin && !inFile {
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(ProfileNames(fileProfiles), ", "))
+	}
+	if isBuiltin {
+		builtin(s)
+	}
+	if inFile {
+		if err := decodeStrict(&node, s); err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Sorted names of built-in and file profiles
+func ProfileNames(fileProfiles map[string]yaml.Node) []string {
+	seen := make(map[string]bool)
+	for name := range builtinProfiles {
+		seen[name] = true
+	}
+	for name := range fileProfiles {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decodes a mapping node into settings, rejecting unknown keys
+func decodeStrict(node *yaml.Node, s *Settings) error {
+	if node.Kind != yaml.MappingNode {
+		return errors.New("expected a mapping of settings")
+	}
+	known := settingKeys()
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if key == "profile" || key == "profiles" {
+			continue
+		}
+		if !known[key] {
+			return fmt.Errorf("line %d: unknown setting %q", node.Content[i].Line, key)
+		}
+	}
+	return node.Decode(s)
+}
+
+// Set of yaml keys accepted in settings files
+func settingKeys() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("yaml"); tag != "" && tag != "-" {
+			keys[tag] = true
+		}
+	}
+	return keys
+}
+
+// Overrides settings from ROBOLIMITED_<YAML_KEY> environment variables
+// Lists are comma-separated; settings with nested structure fail rather than being ignored
+func applyEnv(s *Settings) error {
+	v := reflect.ValueOf(s).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := EnvPrefix + strings.ToUpper(tag)
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetInt(n)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetFloat(f)
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.String {
+				return fmt.Errorf("%s: %s can only be set in a settings file", name, tag)
+			}
+			//Comma-separated list, e.g. ROBOLIMITED_STRATEGIES=margin,rules
+			var items []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		default:
+			return fmt.Errorf("%s: %s can only be set in a settings file", name, tag)
+		}
+	}
+	return nil
+}
+
+// Checks ranges, margins, throttles and file paths; reports every problem found
+func (s *Settings) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(0 <= s.PriceRangeLow && s.PriceRangeLow <= s.PriceRangeHigh, "price_range_low/high: need 0 <= %d <= %d", s.PriceRangeLow, s.PriceRangeHigh)
+	check(0 <= s.RAPRangeLow && s.RAPRangeLow <= s.RAPRangeHigh, "rap_range_low/high: need 0 <= %d <= %d", s.RAPRangeLow, s.RAPRangeHigh)
+
+	check(len(s.Strategies) > 0, "strategies: at least one strategy required")
+	check(len(s.BuyRules) > 0 || !slices.Contains(s.Strategies, "rules"), "buy_rules: required by the rules strategy")
+	if _, err := rules.CompileRules(s.BuyRules, rules.DealFields); err != nil {
+		errs = append(errs, fmt.Errorf("buy_rules: %w", err))
+	}
+	check(0 < s.MarginD && s.MarginD < 1, "margin_d: %v not in (0, 1)", s.MarginD)
+	check(0 < s.MarginND && s.MarginND < 1, "margin_nd: %v not in (0, 1)", s.MarginND)
+	check(0 <= s.MinResaleGap && s.MinResaleGap < 1, "min_resale_gap: %v not in [0, 1)", s.MinResaleGap)
+	check(s.SerialSearchDepth >= 1, "serial_search_depth: %d must be at least 1", s.SerialSearchDepth)
+	check(s.RebuyCooldown >= 0, "rebuy_cooldown: %d must not be negative", s.RebuyCooldown)
+	check(s.MaxDealAge > 0, "max_deal_age: %d must be positive", s.MaxDealAge)
+	check(s.ExitHoldDays >= 0, "exit_hold_days: %v must not be negative", s.ExitHoldDays)
+	check(s.ExitWindow > 0, "exit_window: %d must be positive", s.ExitWindow)
+	check(s.ExitHorizon > 0, "exit_horizon: %d must be positive", s.ExitHorizon)
+	check(s.CSRFMaxAge > 0, "csrf_max_age: %d must be positive", s.CSRFMaxAge)
+	check(s.ReconcileInterval > 0, "reconcile_interval: %d must be positive", s.ReconcileInterval)
+	check(s.OrderTimeout > 0, "order_timeout: %d must be positive", s.OrderTimeout)
+
+	check(s.DipThresholdD >= 0, "dip_threshold_d: %v must not be negative", s.DipThresholdD)
+	check(s.DipThresholdND >= 0, "dip_threshold_nd: %v must not be negative", s.DipThresholdND)
+	check(s.LookbackPeriod > 0, "lookback_period: %d must be positive", s.LookbackPeriod)
+
+	check(0 < s.MaxOwnerHHI && s.MaxOwnerHHI <= 1, "max_owner_hhi: %v not in (0, 1]", s.MaxOwnerHHI)
+	check(0 < s.MaxTop1Share && s.MaxTop1Share <= 1, "max_top1_share: %v not in (0, 1]", s.MaxTop1Share)
+
+	check(s.RefreshRate > 0, "refresh_rate: %d must be positive", s.RefreshRate)
+	check(s.TotalIterations > 0, "total_iterations: %d must be positive", s.TotalIterations)
+	check(s.ActivityTTL > 0, "activity_ttl: %d must be positive", s.ActivityTTL)
+	check(s.DecisionWorkers > 0, "decision_workers: %d must be positive", s.DecisionWorkers)
+	check(s.DealQueueSize > 0, "deal_queue_size: %d must be positive", s.DealQueueSize)
+	check(s.OrderQueueSize > 0, "order_queue_size: %d must be positive", s.OrderQueueSize)
+	check(s.StatsFetchWorkers > 0, "stats_fetch_workers: %d must be positive", s.StatsFetchWorkers)
+	check(s.MonitorThrottle > 0, "monitor_throttle: %d must be positive", s.MonitorThrottle)
+	check(0 <= s.MinThrottle && s.MinThrottle < s.MonitorThrottle, "min_throttle: need 0 <= %d < monitor_throttle", s.MinThrottle)
+	if err := notify.Validate(s.Notifications); err != nil {
+		errs = append(errs, fmt.Errorf("notifications: %w", err))
+	}
+	for key, addr := range map[string]string{"metrics_addr": s.MetricsAddr, "status_addr": s.StatusAddr} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	//Input files must exist, output files need an existing directory
+	errs = append(errs, fileExists("agents_file", s.AgentsFile))
+	if s.StatusAddr != "" {
+		errs = append(errs, dirExists("status_token_file", s.StatusTokenFile))
+	}
+	if s.RotateProxies {
+		errs = append(errs, fileExists("proxy_file", s.ProxyFile))
+	}
+	for key, path := range map[string]string{
+		"action_log_file":        s.ActionLogFile,
+		"console_log_file":       s.ConsoleLogFile,
+		"sales_stats_file":       s.SalesStatsFile,
+		"sales_data_file":        s.SalesDataFile,
+		"serial_model_file":      s.SerialModelFile,
+		"purchase_registry_file": s.PurchaseRegistryFile,
+		"orders_file":            s.OrdersFile,
+		"collectible_cache_file": s.CollectibleCacheFile,
+		"trace_file":             s.TraceFile,
+		"shadow_file":            s.ShadowFile,
+		"ledger_file":            s.LedgerFile,
+		"portfolio_history_file": s.PortfolioHistoryFile,
+	} {
+		errs = append(errs, dirExists(key, path))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid settings:\n%w", err)
+	}
+	return nil
+}
+
+func fileExists(key string, p string) error {
+	if p == "" {
+		return fmt.Errorf("%s: not set", key)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s: %s is a directory", key, p)
+	}
+	return nil
+}
+
+func dirExists(key string, p string) error {
+	if p == "" {
+		return fmt.Errorf("%s: not set", key)
+	}
+	info, err := os.Stat(filepath.Dir(p))
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: %s is not a directory", key, filepath.Dir(p))
+	}
+	return nil
+}
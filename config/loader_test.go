@@ -0,0 +1,42 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(s Settings) bool
+		wantErr string
+	}{
+		{name: "float", env: map[string]string{"ROBOLIMITED_MARGIN_D": "0.3"}, check: func(s Settings) bool { return s.MarginD == 0.3 }},
+		{name: "list", env: map[string]string{"ROBOLIMITED_STRATEGIES": "margin, rules,"}, check: func(s Settings) bool { return slices.Equal(s.Strategies, []string{"margin", "rules"}) }},
+		{name: "bad bool", env: map[string]string{"ROBOLIMITED_LIVE_MONEY": "maybe"}, wantErr: "ROBOLIMITED_LIVE_MONEY"},
+		{name: "nested", env: map[string]string{"ROBOLIMITED_BUY_RULES": "margin > 0.3"}, wantErr: "ROBOLIMITED_BUY_RULES"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			s := Defaults()
+			err := applyEnv(&s)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(s) {
+				t.Errorf("settings not applied from %v", tt.env)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+/*
+Loads credentials from the environment or permission-checked secrets files as Secrets,
+which print, format and marshal as a redaction marker.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"robolimited/secret"
+	"runtime"
+	"strings"
+)
+
+// Environment variable holding the .ROBLOSECURITY cookie
+const CookieEnv = EnvPrefix + "COOKIE"
+
+// Environment variable holding the status page's action token
+const StatusTokenEnv = EnvPrefix + "STATUS_TOKEN"
+
+// Credential whose text, JSON and YAML forms are redacted
+type Secret = secret.Secret
+
+// Wraps a raw credential
+func NewSecret(value string) Secret {
+	return secret.New(value)
+}
+
+/*
+Loads a credential from an environment variable, falling back to a secrets file.
+
+The file must not be readable by group or others (chmod 600). A missing file and
+unset variable yield an unset Secret, since only trading modes need a session.
+*/
+func LoadSecret(envVar string, file string) (Secret, error) {
+	if value := strings.TrimSpace(os.Getenv(envVar)); value != "" {
+		return NewSecret(value), nil
+	}
+	if file == "" {
+		return Secret{}, nil
+	}
+
+	info, err := os.Stat(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return Secret{}, nil
+	}
+	if err != nil {
+		return Secret{}, fmt.Errorf("secrets file: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return Secret{}, fmt.Errorf("secrets file %s has mode %v, must not be accessible by group or others (chmod 600)", file, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Secret{}, fmt.Errorf("secrets file: %w", err)
+	}
+	return NewSecret(strings.TrimSpace(string(data))), nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"robolimited/tools"
+	"sync"
+)
+
+/*
+Precomputed dip thresholds per item so buy checks need no network I/O. Thresholds are
+rebuilt in the background whenever item details refresh; items without sales stats
+(or supply data, when concentrated supply is rejected) are queued for an async fetch
+and skipped until it lands.
+*/
+
+// Buy thresholds of one item for given RAP, value and margin
+type dipThreshold struct {
+	RAP      int
+	Value    int
+	IsDemand bool
+	Margin   float64
+
+	Mean     float64
+	StdDev   float64
+	Cutoff   float64 //Highest z-score counted as a dip
+	DipPrice float64 //Highest price passing the dip check
+	MaxPrice float64 //Highest price passing both the margin and the dip check
+}
+
+func (t dipThreshold) matches(value int, isDemand bool, margin float64) bool {
+	return t.Value == value && t.IsDemand == isDemand && t.Margin == margin
+}
+
+// Computes thresholds from sales stats (same rules as BuyCheck followed by the z-score dip check)
+func newDipThreshold(stats tools.Stats, rap int, value int, isDemand bool, margin float64) dipThreshold {
+	t := dipThreshold{RAP: rap, Value: value, IsDemand: isDemand, Margin: margin, Mean: stats.Mean, StdDev: stats.StdDev}
+	t.Cutoff = dipCutoff(stats.Mean, stats.StdDev, float64(value), isDemand, margin)
+
+	marginPrice := math.Inf(1) //RAP unknown until the next refresh
+	if value != -1 {
+		marginPrice = float64(value) * (1 - margin)
+	} else if rap > 0 {
+		marginPrice = float64(rap) * (1 - margin)
+	}
+	t.DipPrice = stats.Mean + t.Cutoff*stats.StdDev
+	if math.IsNaN(t.DipPrice) {
+		t.DipPrice = 0
+	}
+	t.MaxPrice = math.Min(marginPrice, t.DipPrice)
+	return t
+}
+
+// Shared by the monitor's deciders and executor (nil outside the monitor)
+var decisions *decisionCache
+
+type decisionCache struct {
+	mu         sync.RWMutex
+	stats      map[string]tools.Stats
+	thresholds map[string]dipThreshold
+	supply     map[string]bool //Item id -> supply is concentrated
+	queued     map[string]bool
+	fetches    chan string
+}
+
+// Items waiting for a background fetch (more are dropped and retried later)
+const statsQueueSize = 4096
+
+func newDecisionCache() *decisionCache {
+	c := &decisionCache{
+		stats:      make(map[string]tools.Stats),
+		thresholds: make(map[string]dipThreshold),
+		supply:     make(map[string]bool),
+		queued:     make(map[string]bool),
+		fetches:    make(chan string, statsQueueSize),
+	}
+	//Seed with stats loaded from the sales stats file
+	for id, stats := range tools.SalesStats {
+		if stats.StdDev > 0 {
+			c.stats[id] = stats
+		}
+	}
+	return c
+}
+
+// Cached sales stats of an item, queueing a fetch if missing
+func (c *decisionCache) Stats(id string) (tools.Stats, bool) {
+	c.mu.RLock()
+	stats, ok := c.stats[id]
+	c.mu.RUnlock()
+	if !ok {
+		c.enqueue(id)
+	}
+	return stats, ok
+}
+
+/*
+Checks whether price is a dip, and supply is not concentrated, without network I/O. Returns false with a
+reason when it is not, or when the item's data is still being fetched.
+*/
+func (c *decisionCache) CheckDip(id string, price float64, value int, isDemand bool, margin float64) (bool, string) {
+	c.mu.RLock()
+	threshold, ok := c.thresholds[id]
+	stats, hasStats := c.stats[id]
+	concentrated, hasSupply := c.supply[id]
+	c.mu.RUnlock()
+
+	if !hasStats {
+		c.enqueue(id)
+		return false, "sales stats pending"
+	}
+	if !ok || !threshold.matches(value, isDemand, margin) {
+		threshold = newDipThreshold(stats, threshold.RAP, value, isDemand, margin)
+		c.mu.Lock()
+		c.thresholds[id] = threshold
+		c.mu.Unlock()
+	}
+
+	if price > threshold.DipPrice {
+		return false, fmt.Sprintf("no dip below %.0f (z cutoff %.2f)", threshold.DipPrice, threshold.Cutoff)
+	}
+
+	//Reject hoarded items whose price can be easily manipulated
+	if settings.RejectConcentrated {
+		if !hasSupply {
+			c.enqueue(id)
+			return false, "supply data pending"
+		}
+		if concentrated {
+			return false, "concentrated supply"
+		}
+	}
+	return true, fmt.Sprintf("dip below %.0f (z cutoff %.2f)", threshold.DipPrice, threshold.Cutoff)
+}
+
+// Rebuilds thresholds for every tradable item, queueing items that lack data
+func (c *decisionCache) Refresh(itemDetails *tools.ItemDetails, watchlist *tools.Watchlist) {
+	if itemDetails == nil {
+		return
+	}
+	thresholds := make(map[string]dipThreshold)
+	var missing []string
+
+	c.mu.RLock()
+	for id, details := range itemDetails.Items {
+		if len(details) < 10 {
+			continue
+		}
+		rap, _ := details[2].(float64)
+		value, _ := details[3].(float64)
+		levels := itemLevels(details)
+		if levels.Projected != -1 || !(settings.RAPRangeLow <= int(rap) && int(rap) <= settings.RAPRangeHigh) {
+			continue
+		}
+		acronym, _ := details[1].(string)
+		rule, allowed := watchlist.Lookup(id, acronym)
+		if !allowed {
+			continue
+		}
+
+		isDemand := levels.Demand >= 1
+		margin := demandMargin(isDemand)
+		if rule.Margin != nil {
+			margin = *rule.Margin
+		}
+
+		stats, ok := c.stats[id]
+		_, hasSupply := c.supply[id]
+		if !ok || (settings.RejectConcentrated && !hasSupply) {
+			missing = append(missing, id)
+		}
+		if ok {
+			thresholds[id] = newDipThreshold(stats, int(rap), int(value), isDemand, margin)
+		}
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	c.thresholds = thresholds
+	c.mu.Unlock()
+
+	for _, id := range missing {
+		c.enqueue(id)
+	}
+	if settings.LogConsole {
+		log.Println("Decision cache | Items:", len(thresholds), "| Missing data:", len(missing))
+	}
+}
+
+// Queues an item for a background fetch unless already queued (dropped if the queue is full)
+func (c *decisionCache) enqueue(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.queued[id] {
+		return
+	}
+	select {
+	case c.fetches <- id:
+		c.queued[id] = true
+	default:
+	}
+}
+
+// Fetches queued items' stats and supply until ctx is cancelled
+func (c *decisionCache) run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-c.fetches:
+					c.fetch(id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *decisionCache) fetch(id string) {
+	c.mu.RLock()
+	_, hasStats := c.stats[id]
+	_, hasSupply := c.supply[id]
+	c.mu.RUnlock()
+
+	var stats tools.Stats
+	if !hasStats {
+		stats.Mean, stats.StdDev, _, _ = processPriceSeries(id, settings.LookbackPeriod, 0)
+	}
+	concentrated := false
+	var supplyErr error
+	if settings.RejectConcentrated && !hasSupply {
+		var supply tools.SupplyMetrics
+		supply, supplyErr = findSupply(id)
+		concentrated = supply.IsConcentrated(settings.MaxOwnerHHI, settings.MaxTop1Share)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.queued, id) //Failed fetches are retried the next time the item is seen
+	if !hasStats && stats.StdDev > 0 {
+		c.stats[id] = stats
+	}
+	if settings.RejectConcentrated && !hasSupply && supplyErr == nil {
+		c.supply[id] = concentrated
+	}
+	if supplyErr != nil {
+		log.Println("Could not check supply of", id, ":", supplyErr)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"robolimited/tools"
+	"strconv"
+	"time"
+)
+
+/*
+Exit planning for held lots: -mode=exits ranks sell plans for the account inventory,
+and with paper_exits the monitor sells simulated lots by their plans (paper only).
+*/
+
+// Days of sales history behind exit forecasts while monitoring
+const exitHistoryDays = 365 * 5
+
+// Days of sales counted for liquidity
+const liquidityDays = 30
+
+func exitRules() tools.ExitRules {
+	return tools.ExitRules{
+		Hold:    time.Duration(settings.ExitHoldDays * float64(24*time.Hour)),
+		Window:  time.Duration(settings.ExitWindow) * 24 * time.Hour,
+		Horizon: settings.ExitHorizon,
+	}
+}
+
+// Forecast and liquidity of an item for exit planning
+func exitMarket(id string, details []interface{}, daysPast int64) tools.ExitMarket {
+	rap, _ := details[2].(float64)
+	value, _ := details[3].(float64)
+	market := tools.ExitMarket{RAP: int(rap), Value: int(value)}
+	market.Forecast, _, market.Peaks, _, market.PeakRatios, _ = modelFourierSTL(id, daysPast, int64(settings.ExitHorizon), false)
+
+	sales := tools.SalesData[id]
+	if sales == nil {
+		_, _, sales, _ = processPriceSeries(id, liquidityDays, 0)
+	}
+	market.SalesPerDay = tools.SalesPerDay(sales, liquidityDays)
+	return market
+}
+
+// Lots in the account inventory, with cost basis from the ledger where known
+func inventoryLots(itemDetails *tools.ItemDetails) []tools.ExitLot {
+	inventory, _, err := reconcileInventory()
+	if err != nil {
+		fmt.Println("Could not fetch inventory:", err)
+		return nil
+	}
+
+	var lots []tools.ExitLot
+	for id, uaids := range inventory {
+		details := itemDetails.Items[id]
+		if len(details) < 4 {
+			continue
+		}
+		name, _ := details[0].(string)
+		rap, _ := details[2].(float64)
+		value, _ := details[3].(float64)
+		for _, uaid := range uaids {
+			lot := tools.ExitLot{AssetID: id, Name: name, Source: "inventory", Cost: int(max(rap, value))}
+			if entry, ok := ledger.ByUAID(uaid); ok {
+				lot.Cost, lot.CostKnown, lot.Serial, lot.Acquired = entry.Cost, true, entry.Serial, entry.Date
+			}
+			lots = append(lots, lot)
+		}
+	}
+	return lots
+}
+
+// Prints a ranked sell plan for the account inventory
+func showExits(limit int, daysPast int64) {
+	itemDetails := tools.GetLimitedData()
+	if itemDetails == nil {
+		fmt.Println("Could not get item details")
+		return
+	}
+	now := time.Now()
+	rules := exitRules()
+	markets := make(map[string]tools.ExitMarket)
+	var plans []tools.ExitPlan
+	for _, lot := range inventoryLots(itemDetails) {
+		market, ok := markets[lot.AssetID]
+		if !ok {
+			market = exitMarket(lot.AssetID, itemDetails.Items[lot.AssetID], daysPast)
+			markets[lot.AssetID] = market
+		}
+		plans = append(plans, tools.PlanExit(lot, market, rules, now))
+	}
+	tools.RankExits(plans)
+
+	fmt.Println("____________________________________________________")
+	net, profit := 0, 0
+	for i, plan := range plans {
+		if limit > 0 && i >= limit {
+			break
+		}
+		fmt.Println(strconv.Itoa(i+1)+".", plan)
+		net += plan.Net
+		profit += plan.Profit
+	}
+	fmt.Println("____________________________________________________")
+	fmt.Println("Lots:", len(plans), "| Shown net:", net, "| Shown profit:", profit, "| Fee:", tools.MarketplaceFee*100, "%")
+}
+
+// Sells simulated lots whose sell window is open once RAP reaches the list price (paper only)
+func (p *pipeline) paperExits(itemDetails *tools.ItemDetails) {
+	if itemDetails == nil || !p.exiting.CompareAndSwap(false, true) {
+		return
+	}
+	defer p.exiting.Store(false)
+
+	//Snapshot lots so forecasts run without holding the ledgers
+	type heldLot struct {
+		runner int
+		id     string
+		lot    tools.Lot
+	}
+	var held []heldLot
+	p.simMu.Lock()
+	for k, r := range p.runners {
+		for id, lots := range r.sim.Portfolio {
+			for _, lot := range lots {
+				held = append(held, heldLot{runner: k, id: id, lot: lot})
+			}
+		}
+	}
+	p.simMu.Unlock()
+
+	now := time.Now()
+	rules := exitRules()
+	markets := make(map[string]tools.ExitMarket)
+	for _, h := range held {
+		details := itemDetails.Items[h.id]
+		if len(details) < 4 {
+			continue
+		}
+		market, ok := markets[h.id]
+		if !ok {
+			market = exitMarket(h.id, details, exitHistoryDays)
+			markets[h.id] = market
+		}
+		r := p.runners[h.runner]
+		name, _ := details[0].(string)
+		plan := tools.PlanExit(tools.ExitLot{
+			AssetID:   h.id,
+			Name:      name,
+			Source:    r.strategy.Name(),
+			Cost:      h.lot.Price,
+			CostKnown: true,
+			Serial:    h.lot.Serial,
+			Acquired:  h.lot.Time,
+		}, market, rules, now)
+
+		//Hold losing lots; a paper sale fills once recent sales reach the list price
+		if plan.Profit < 0 || !plan.Open(now) || market.RAP < plan.ListPrice {
+			continue
+		}
+		p.simMu.Lock()
+		sold := r.sim.SellLot(h.id, name, h.lot, plan.ListPrice)
+		p.simMu.Unlock()
+		if sold {
+			paperSales.Inc(r.strategy.Name())
+			log.Println("Paper sold", plan)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"robolimited/tools"
+	"time"
+)
+
+/*
+Per-deal latency from the Rolimons activity time to the purchase outcome. Stages:
+poll (listing to receipt), queue, decision, order_queue, then the purchase steps
+resolve, resellers, select, post and result.
+*/
+
+// Recorder of the running monitor (nil outside the monitor)
+var latencies *tools.LatencyRecorder
+
+// Logs in-memory latency histograms of this run
+func logLatencies() {
+	stages := latencies.Latencies()
+	if len(stages) == 0 {
+		return
+	}
+	log.Println("Deal latency (histogram buckets):")
+	for _, stage := range stages {
+		log.Println(stage)
+	}
+}
+
+// Prints p50/p95/p99 per stage over recorded traces, optionally of one item or outcome
+func showLatency(itemId string, outcome string) {
+	traces, err := tools.ReadTraces(settings.TraceFile)
+	if err != nil {
+		fmt.Println("Could not read traces:", err)
+		return
+	}
+
+	var shown []tools.Trace
+	outcomes := make(map[string]int)
+	for _, trace := range traces {
+		if (itemId == "" || trace.AssetID == itemId) && (outcome == "" || trace.Outcome == outcome) {
+			shown = append(shown, trace)
+			outcomes[trace.Outcome]++
+		}
+	}
+	if len(shown) == 0 {
+		fmt.Println("No traces recorded in", settings.TraceFile)
+		return
+	}
+
+	fmt.Println("____________________________________________________")
+	fmt.Println("Traces:", len(shown), "| From:", shown[0].Activity.Format(time.DateTime), "| Outcomes:", outcomes)
+	for _, stage := range tools.TraceLatencies(shown) {
+		fmt.Println(stage)
+	}
+	fmt.Println("____________________________________________________")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"robolimited/tools"
+	"time"
+)
+
+/*
+Monitor metrics served on an optional HTTP /metrics endpoint (metrics_addr) for
+charting long-running sessions. API errors are counted in tools.
+*/
+
+var (
+	pollsTotal     = tools.Metrics.Counter("robolimited_polls_total", "Deal polls completed")
+	activitiesSeen = tools.Metrics.Counter("robolimited_activities_seen_total", "Deal activities returned by polls")
+	activitiesNew  = tools.Metrics.Counter("robolimited_activities_new_total", "Deal activities not seen in earlier polls")
+	decisionsTotal = tools.Metrics.Counter("robolimited_decisions_total", "Strategy decisions by outcome", "strategy", "outcome")
+	purchasesTotal = tools.Metrics.Counter("robolimited_purchases_total", "Buy orders by result", "strategy", "result")
+	spendTotal     = tools.Metrics.Counter("robolimited_spend_robux_total", "Robux spent by strategy, with real money (live) or simulated (paper)", "strategy", "mode")
+	shadowFills    = tools.Metrics.Counter("robolimited_shadow_fills_total", "Shadow checks of paper buys by result (filled, missed, error)", "strategy", "result")
+	paperSales     = tools.Metrics.Counter("robolimited_paper_sales_total", "Simulated lots sold by their exit plan", "strategy")
+	simPnL         = tools.Metrics.Gauge("robolimited_sim_pnl_robux", "P&L of simulated trading: holdings at current RAP/value plus sale proceeds minus spend", "strategy")
+	itemDetailsAge = tools.Metrics.Gauge("robolimited_item_details_age_seconds", "Seconds since item details were last refreshed")
+)
+
+// Serves /metrics on addr until ctx is cancelled
+func serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", tools.Metrics.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Println("Serving metrics on http://" + addr + "/metrics")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println("Metrics endpoint stopped:", err)
+	}
+}
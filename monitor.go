@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
-	"math"
-	"robolimited/config"
+	"os"
+	"os/signal"
+	"robolimited/notify"
 	"robolimited/tools"
-	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -14,24 +18,24 @@ Monitors economy for price anomalies and market fluctuations through API request
 Integrates the analyzer and sniper to detect dips and execute purchases.
 */
 
-// Evaluates if margins are good enough to buy
-func BuyF(rap_margin float64, value_margin float64, hasValue bool, isDemand bool) bool {
-	//Implement demand evaluation (higher demand items have lower margin standards)
+// Default margin for an item's demand level (higher demand items have lower margin standards)
+func demandMargin(isDemand bool) float64 {
 	if isDemand {
-		if hasValue {
-			return value_margin >= config.MarginD
-		}
-		return rap_margin >= config.MarginD
-	} else {
-		if hasValue {
-			return value_margin >= config.MarginND
-		}
-		return rap_margin >= config.MarginND
+		return settings.MarginD
 	}
+	return settings.MarginND
+}
+
+// Evaluates if margins are good enough to buy
+func BuyF(rap_margin float64, value_margin float64, hasValue bool, margin float64) bool {
+	if hasValue {
+		return value_margin >= margin
+	}
+	return rap_margin >= margin
 }
 
 // Make decision on whether to buy or stand
-func BuyCheck(bestPrice int, RAP_r int, value_r int, isDemand bool) bool {
+func BuyCheck(bestPrice int, RAP_r int, value_r int, margin float64) bool {
 	if bestPrice == 0 { //Error occurred or no resellers if price is 0
 		return false
 	}
@@ -40,140 +44,186 @@ func BuyCheck(bestPrice int, RAP_r int, value_r int, isDemand bool) bool {
 	bpF := float64(bestPrice)
 	if value == -1 {
 		//RAP limited
-		return BuyF((RAP-bpF)/RAP, -1, false, isDemand)
+		return BuyF((RAP-bpF)/RAP, -1, false, margin)
 	} else {
 		//Value limited
-		return BuyF((RAP-bpF)/RAP, (value-bpF)/value, true, isDemand)
+		return BuyF((RAP-bpF)/RAP, (value-bpF)/value, true, margin)
 	}
 }
 
-// Throttles deal polling to avoid rate limit
-func throttleMonitor() {
+// Throttles deal polling to avoid rate limit; false if cancelled while waiting
+func throttleMonitor(ctx context.Context) bool {
 	//Sync throttle to unix offset for staggered scheduling
-	var interval int64 = config.MonitorThrottle
+	var interval int64 = settings.MonitorThrottle
 	offset := time.Now().UnixMilli() % interval
-	yieldTime := ((config.ClockOffset - offset) + interval) % interval
+	yieldTime := ((settings.ClockOffset - offset) + interval) % interval
 
 	//Ensure yield time does not drop below min
-	if yieldTime < config.MinThrottle {
+	if yieldTime < settings.MinThrottle {
 		yieldTime += interval
 	}
-	time.Sleep(time.Duration(yieldTime) * time.Millisecond)
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(time.Duration(yieldTime) * time.Millisecond):
+		return true
+	}
 }
 
-// Monitor limited deals via Rolimon's deals page
-func snipeDeals(live_money bool) {
-	//Make dummy purchase for X-CSRF token
-	ExecutePurchase("21070012", true, -1, false)
-
-	var tradeSim *tools.TradeSimulator = tools.NewTradeSimulator()
+// Workers resolving collectible ids at monitor start
+const resolveWorkers = 4
 
-	//id -> [item_name, acronym, rap, value, default_value, demand, trend, projected, hyped, rare]
+// Resolves collectible ids of every item that could be bought within the price range
+func preresolveCollectibles() {
 	itemDetails := tools.GetLimitedData()
+	if itemDetails == nil {
+		log.Println("Could not pre-resolve collectible ids: no item details")
+		return
+	}
 
-	RAP_map := map[string]int{}
-
-	for i := range config.TotalIterations {
+	var ids []string
+	for id, details := range itemDetails.Items {
+		if len(details) < 10 {
+			continue
+		}
+		rap, _ := details[2].(float64)
+		value, _ := details[3].(float64)
+		worth := rap
+		if value != -1 {
+			worth = value
+		}
+		//Lowest price that could pass the margin check must be within the price range
+		lowestBuy := worth * (1 - max(settings.MarginD, settings.MarginND))
+		if float64(settings.PriceRangeLow) <= worth && lowestBuy <= float64(settings.PriceRangeHigh) &&
+			settings.RAPRangeLow <= int(rap) && int(rap) <= settings.RAPRangeHigh {
+			ids = append(ids, id)
+		}
+	}
 
-		//Bind throttle to unix timemark
-		throttleMonitor()
+	start := time.Now()
+	failed := tools.Collectibles().Preresolve(ids, resolveWorkers)
+	log.Println("Resolved collectible ids |", len(ids)-len(failed), "/", len(ids), "items in range |", time.Since(start).Round(time.Millisecond))
+	for id, err := range failed {
+		name, _ := itemDetails.Items[id][0].(string)
+		log.Println("Could not resolve collectible id of", name, "(", id, "):", err)
+	}
+}
 
-		if config.LogConsole {
-			log.Println("____________________________________________________")
+// Monitor limited deals via Rolimon's deals page
+func snipeDeals(live_money bool) {
+	//Validate session before trading
+	account, err := tools.ValidateSession()
+	if err != nil {
+		if live_money {
+			log.Println("Cannot trade with live money:", err)
+			if errors.Is(err, tools.ErrSessionExpired) {
+				notifier.Notify(notify.SessionExpired(err))
+			} else {
+				notifier.Notify(notify.Monitor(notify.Critical, "not started", "cannot trade with live money: "+err.Error()))
+			}
+			return
 		}
+		log.Println("Session check failed, continuing with simulated costs:", err)
+	} else {
+		log.Println("Session valid for", account.Name, "(", account.Id, ")")
 
-		if i%config.RefreshRate == 0 {
-			//Recalculate RAP / Value and limited data from Rolimon API
-			itemDetailsNew := tools.GetLimitedData()
-			if itemDetailsNew == nil {
-				//Mark errors in updating
-				log.Println("Could not refresh item details..")
-			} else {
-				itemDetails = itemDetailsNew
+		//Fetch X-CSRF token before the first purchase
+		if live_money {
+			if _, err := tokens.EnsureFresh(time.Duration(settings.CSRFMaxAge) * time.Second); err != nil {
+				log.Println("Could not fetch X-CSRF token:", err)
 			}
 		}
+	}
 
-		//[[timestamp, isRAP, id, bestPrice / RAP]]
-		dealDetails := tools.GetDealsData()
-		if dealDetails == nil {
-			continue
-		} //Catch error, wait for resolution
+	//Per-item watchlist / blocklist, reloaded whenever the file changes
+	watchlist, err := tools.LoadWatchlist(settings.WatchlistFile)
+	if err != nil {
+		log.Println("Could not load watchlist:", err)
+		return
+	}
+	if watchlist.Current() == nil {
+		log.Println("WARNING: no watchlist at", settings.WatchlistFile, "- no items are blocked and every item may be bought")
+	}
 
-		activities := dealDetails.Activities
+	//Resolve collectible ids up front so purchases skip the catalog lookup
+	if live_money {
+		preresolveCollectibles()
+	}
 
-		for _, info := range activities {
-			isRAP := int(info[1].(float64))
-			id_r := int(info[2].(float64))
-			id := strconv.Itoa(id_r)
-			price := int(info[3].(float64))
+	//Each strategy keeps its own simulated ledger; only the first may trade live
+	active, err := NewStrategies(settings.Strategies)
+	if err != nil {
+		log.Println("Could not start strategies:", err)
+		return
+	}
+	runners := make([]strategyRunner, len(active))
+	for k, strategy := range active {
+		runners[k] = strategyRunner{strategy: strategy, sim: tools.NewTradeSimulator()}
+		runners[k].sim.Registry = purchases
+		if len(active) > 1 {
+			runners[k].sim.Name = strategy.Name()
+		}
+	}
 
-			//Handle not found error
-			if itemDetails == nil || len(itemDetails.Items[id]) == 0 {
-				continue
-			}
+	//Stop polling on interrupt and let queued work drain
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, kill := context.WithCancel(ctx)
+	defer kill()
 
-			isDemand := int(itemDetails.Items[id][5].(float64)) >= 1
-			projected := int(itemDetails.Items[id][7].(float64))
+	//Fetch missing sales stats and supply in the background
+	decisions = newDecisionCache()
+	go decisions.run(ctx, settings.StatsFetchWorkers)
 
-			//Exclude projected items and erroneous listings
-			if projected != -1 || price < 1 {
-				continue
-			}
-			//Exclude items out of price range
-			if !(config.PriceRangeLow <= price && price <= config.PriceRangeHigh) {
-				continue
-			}
+	//Confirm live orders against inventory while trading
+	if live_money {
+		go runReconciler(ctx)
+	}
 
-			//Scan for item details
-			name := itemDetails.Items[id][0].(string)
-			value := int(itemDetails.Items[id][3].(float64))
-			_, inMap := RAP_map[id]
-			if !inMap {
-				RAP_map[id] = int(itemDetails.Items[id][2].(float64))
-			}
+	//Refit serial premiums from observed listings
+	go runSerialModel(ctx)
 
-			//Exclude items out of RAP range
-			if !(config.RAPRangeLow <= RAP_map[id] && RAP_map[id] <= config.RAPRangeHigh) {
-				continue
-			}
+	//Expose counters and gauges for scraping
+	if settings.MetricsAddr != "" {
+		go serveMetrics(ctx, settings.MetricsAddr)
+	}
 
-			if isRAP == 0 { //Updating best price
-				//Make decision to purchase item
-
-				//Initial % margin filter of current price and RAP
-				if !BuyCheck(price, RAP_map[id], value, isDemand) {
-					continue
-				}
-
-				//Deeper price anomaly dip check using z-score below % margins
-				if CheckDip(id, float64(price), float64(value), isDemand) {
-					//BUY
-					if live_money {
-						ExecutePurchase(id, false, float64(value), isDemand)
-					}
-					tradeSim.BuyItem(id, name, price)
-				}
-
-				if config.LogConsole {
-					log.Println("Scanned", name, "|", "RAP:", RAP_map[id], "| Value:", value, "| Price: ", price, "| Deal: ", math.Round(float64(max(RAP_map[id], value)-price)/float64(max(RAP_map[id], value))*1000.0)/10.0, "%")
-				}
-
-			} else { //Updating RAP
-				RAP_map[id] = price
-
-				if config.LogConsole {
-					log.Println("Updated", name, "|", "RAP:", RAP_map[id], "| Value:", value, "| Price: ", price)
-				}
-			}
-		}
+	//Trace deal latency from listing to outcome
+	latencies = tools.NewLatencyRecorder(settings.TraceFile)
+	defer latencies.Close()
+
+	//Check paper buys against live listings
+	if settings.ShadowFills {
+		shadows = tools.NewShadowRecorder(settings.ShadowFile)
+		defer shadows.Close()
+	}
+
+	p := newPipeline(settings, live_money, runners, watchlist)
+
+	//Status page with pause / resume and kill switch
+	if settings.StatusAddr != "" {
+		go serveStatus(ctx, settings.StatusAddr, p, kill)
+	}
+
+	mode := "simulated"
+	if live_money {
+		mode = "live"
 	}
+	notifier.Notify(notify.Monitor(notify.Info, "started", mode+" trading with "+strings.Join(settings.Strategies, ", ")))
+
+	p.run(ctx)
+	serialModel.Refit(settings.SerialModelFile)
+	logStrategySummary(runners)
+	logShadowFills()
+	logLatencies()
+	notifier.Notify(notify.Monitor(notify.Info, "stopped", mode+" trading"))
 }
 
 // Driver
 /* DEPRECATED, RUN FROM CLI
 func main() {
 	//Start deal sniper process
-	//monitorDeals(config.LiveMoney)
+	//monitorDeals(settings.LiveMoney)
 
 	//===Analyzer Methods===\\
 
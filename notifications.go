@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"robolimited/notify"
+)
+
+/*
+Notifications of purchases, failures, session expiry, monitor state and search
+results, sent to the sinks listed under notifications in the settings.
+*/
+
+// Shared notifier (nil when no sinks are configured, which Notify accepts)
+var notifier *notify.Notifier
+
+func initNotifier() {
+	if len(settings.Notifications) == 0 {
+		return
+	}
+	var err error
+	notifier, err = notify.New(settings.Notifications)
+	if err != nil {
+		log.Println("Notifications disabled:", err)
+	}
+}
+
+// Sends a test event straight to every sink, reporting each failure
+func checkNotifiers() {
+	if notifier.Len() == 0 {
+		fmt.Println("No notification sinks configured")
+		return
+	}
+	err := notifier.SendNow(notify.Event{
+		Kind:     notify.KindTest,
+		Severity: notify.Critical,
+		Title:    "Test notification",
+		Message:  "Sent by -mode=checkNotifiers",
+	})
+	if err != nil {
+		fmt.Println("Notifier check FAILED:", err)
+		return
+	}
+	fmt.Println("Notifier check passed for", notifier.Len(), "sinks")
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Live purchase accepted by the API
+func Purchase(itemId string, price int, serial int64) Event {
+	e := Event{
+		Kind:     KindPurchase,
+		Severity: Info,
+		Title:    "Bought " + itemId + " for " + strconv.Itoa(price),
+		Fields:   map[string]string{"item": itemId, "price": strconv.Itoa(price)},
+	}
+	if serial > 0 {
+		e.Fields["serial"] = strconv.FormatInt(serial, 10)
+	}
+	return e
+}
+
+// Live purchase rejected or lost; an insufficient balance is reported as its own kind
+func PurchaseFailed(itemId string, price int, reason string) Event {
+	e := Event{
+		Kind:     KindPurchaseFailed,
+		Severity: Warning,
+		Title:    "Purchase of " + itemId + " failed",
+		Message:  reason,
+		Fields:   map[string]string{"item": itemId, "price": strconv.Itoa(price)},
+	}
+	if IsInsufficientBalance(reason) {
+		e.Kind = KindInsufficientBalance
+		e.Severity = Critical
+		e.Title = "Insufficient balance to buy " + itemId
+	}
+	return e
+}
+
+// Whether a purchase failure reason reports an insufficient Robux balance
+func IsInsufficientBalance(reason string) bool {
+	reason = strings.ToLower(strings.ReplaceAll(reason, " ", ""))
+	return strings.Contains(reason, "insufficientbalance") || strings.Contains(reason, "insufficientfunds")
+}
+
+// Session cookie rejected by Roblox
+func SessionExpired(err error) Event {
+	return Event{
+		Kind:     KindSessionExpired,
+		Severity: Critical,
+		Title:    "Roblox session expired",
+		Message:  err.Error(),
+	}
+}
+
+// Monitor lifecycle change (started, stopped, paused, resumed, killed)
+func Monitor(severity Severity, state string, detail string) Event {
+	return Event{
+		Kind:     KindMonitor,
+		Severity: severity,
+		Title:    "Monitor " + state,
+		Message:  detail,
+	}
+}
+
+// Items found by a market search, listing at most the first ten
+func SearchResults(search string, items []string) Event {
+	e := Event{
+		Kind:     KindSearchResults,
+		Severity: Info,
+		Title:    fmt.Sprintf("%s found %d items", search, len(items)),
+		Fields:   map[string]string{"search": search, "count": strconv.Itoa(len(items))},
+	}
+	if len(items) > 0 {
+		e.Message = strings.Join(items[:min(len(items), 10)], ", ")
+	}
+	return e
+}
+
+// Watch target condition met by an item
+func Alert(itemId string, name string, price int, condition string, detail string) Event {
+	return Event{
+		Kind:     KindAlert,
+		Severity: Warning,
+		Title:    name + " " + condition,
+		Message:  detail,
+		Fields:   map[string]string{"item": itemId, "price": strconv.Itoa(price), "condition": condition},
+	}
+}
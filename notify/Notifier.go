@@ -0,0 +1,336 @@
+package notify
+
+/*
+Sends typed events (purchases, failures, session expiry, search results, alerts) to
+pluggable sinks. Every sink has its own queue with a severity filter, a rate limit and
+batching, so a slow or failing sink never blocks trading or the other sinks.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+var severityNames = []string{"info", "warning", "critical"}
+
+func (s Severity) String() string {
+	if s < Info || s > Critical {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	parsed, err := ParseSeverity(string(text))
+	*s = parsed
+	return err
+}
+
+// Parses info, warning or critical (empty means info)
+func ParseSeverity(name string) (Severity, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return Info, nil
+	}
+	for i, known := range severityNames {
+		if name == known {
+			return Severity(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown severity %q (want info, warning or critical)", name)
+}
+
+type Kind string
+
+const (
+	KindPurchase            Kind = "purchase"
+	KindPurchaseFailed      Kind = "purchase_failed"
+	KindInsufficientBalance Kind = "insufficient_balance"
+	KindSessionExpired      Kind = "session_expired"
+	KindMonitor             Kind = "monitor"
+	KindSearchResults       Kind = "search_results"
+	KindAlert               Kind = "alert"
+	KindSuppressed          Kind = "suppressed"
+	KindTest                Kind = "test"
+)
+
+// One notification
+type Event struct {
+	Kind     Kind              `json:"kind"`
+	Severity Severity          `json:"severity"`
+	Time     time.Time         `json:"time"`
+	Title    string            `json:"title"`
+	Message  string            `json:"message,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// Destination of notifications
+type Sink interface {
+	Name() string
+	Send(events []Event) error
+}
+
+// Events waiting per sink before new ones are dropped
+const queueSize = 256
+
+// Time source for event stamps, rate limits and batch windows (replaced in tests)
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Queue, filter, rate limit and batching in front of one sink
+type dispatcher struct {
+	sink        Sink
+	clock       clock
+	minSeverity Severity
+	limiter     *rateLimiter
+	batchSize   int
+	batchWindow time.Duration
+
+	events     chan Event
+	done       chan struct{}
+	suppressed atomic.Int64 //Events dropped by the rate limit or a full queue since the last batch
+}
+
+func newDispatcher(sink Sink, c SinkConfig, minSeverity Severity, clock clock) *dispatcher {
+	d := &dispatcher{
+		sink:        sink,
+		clock:       clock,
+		minSeverity: minSeverity,
+		batchSize:   max(c.BatchSize, 1),
+		batchWindow: time.Duration(c.BatchWindow * float64(time.Second)),
+		events:      make(chan Event, queueSize),
+		done:        make(chan struct{}),
+	}
+	if c.RateLimit > 0 {
+		d.limiter = newRateLimiter(c.RateLimit, time.Minute)
+	}
+	go d.run()
+	return d
+}
+
+// Queues an event unless filtered out; critical events skip the rate limit
+func (d *dispatcher) offer(e Event) {
+	if e.Severity < d.minSeverity {
+		return
+	}
+	if e.Severity < Critical && d.limiter != nil && !d.limiter.allow(e.Time) {
+		d.suppressed.Add(1)
+		return
+	}
+	select {
+	case d.events <- e:
+	default:
+		d.suppressed.Add(1)
+	}
+}
+
+// Sends batches until the queue is closed
+func (d *dispatcher) run() {
+	defer close(d.done)
+	for first := range d.events {
+		batch := []Event{first}
+		closed := false
+		var window <-chan time.Time
+		if d.batchWindow > 0 {
+			window = d.clock.After(d.batchWindow)
+		}
+	collect:
+		for len(batch) < d.batchSize {
+			if window == nil {
+				//Take what is already queued without waiting
+				select {
+				case e, ok := <-d.events:
+					if !ok {
+						closed = true
+						break collect
+					}
+					batch = append(batch, e)
+				default:
+					break collect
+				}
+				continue
+			}
+			select {
+			case e, ok := <-d.events:
+				if !ok {
+					closed = true
+					break collect
+				}
+				batch = append(batch, e)
+			case <-window:
+				break collect
+			}
+		}
+		d.send(batch)
+		if closed {
+			break
+		}
+	}
+	//Report events suppressed after the last batch
+	if d.suppressed.Load() > 0 {
+		d.send(nil)
+	}
+}
+
+func (d *dispatcher) send(batch []Event) {
+	if n := d.suppressed.Swap(0); n > 0 {
+		batch = append(batch, Event{
+			Kind:     KindSuppressed,
+			Severity: Warning,
+			Time:     d.clock.Now(),
+			Title:    fmt.Sprintf("%d notifications suppressed by rate limit", n),
+		})
+	}
+	if err := d.sink.Send(batch); err != nil {
+		log.Println("Notification sink", d.sink.Name(), "failed:", err)
+	}
+}
+
+// Token bucket allowing n events per period
+type rateLimiter struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64 //Tokens per second
+	last     time.Time
+}
+
+func newRateLimiter(n int, period time.Duration) *rateLimiter {
+	return &rateLimiter{capacity: float64(n), tokens: float64(n), rate: float64(n) / period.Seconds()}
+}
+
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens = min(l.capacity, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Fans events out to every configured sink
+type Notifier struct {
+	dispatchers []*dispatcher
+	clock       clock
+	mu          sync.RWMutex
+	closed      bool
+}
+
+// Builds sinks from their settings
+func New(configs []SinkConfig) (*Notifier, error) {
+	n := &Notifier{clock: realClock{}}
+	var errs []error
+	for i, c := range configs {
+		sink, minSeverity, err := c.build()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("[%d] %s: %w", i, c.Type, err))
+			continue
+		}
+		n.dispatchers = append(n.dispatchers, newDispatcher(sink, c, minSeverity, n.clock))
+	}
+	if err := errors.Join(errs...); err != nil {
+		n.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// Queues an event for every sink (no-op on a nil or closed notifier)
+func (n *Notifier) Notify(e Event) {
+	if n == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = n.clock.Now()
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return
+	}
+	for _, d := range n.dispatchers {
+		d.offer(e)
+	}
+}
+
+// Sends an event to every sink right away, bypassing filters and batching
+func (n *Notifier) SendNow(e Event) error {
+	if n == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = n.clock.Now()
+	}
+	var errs []error
+	for _, d := range n.dispatchers {
+		if err := d.sink.Send([]Event{e}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Number of configured sinks
+func (n *Notifier) Len() int {
+	if n == nil {
+		return 0
+	}
+	return len(n.dispatchers)
+}
+
+// Flushes queued events, waiting up to 10 seconds for slow sinks
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	for _, d := range n.dispatchers {
+		close(d.events)
+	}
+	n.mu.Unlock()
+
+	timeout := time.After(10 * time.Second)
+	for _, d := range n.dispatchers {
+		select {
+		case <-d.done:
+		case <-timeout:
+			log.Println("Notification sink", d.sink.Name(), "did not flush in time")
+		}
+	}
+}
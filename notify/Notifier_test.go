@@ -0,0 +1,272 @@
+package notify
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Clock moved forward by hand; After fires once the clock passes its deadline
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan struct{} //Signalled when After is called
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), waiting: make(chan struct{}, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	c.waiting <- struct{}{}
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// Sink handing every batch to the test
+type recordingSink struct {
+	batches chan []Event
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{batches: make(chan []Event, 64)}
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Send(events []Event) error {
+	s.batches <- append([]Event(nil), events...)
+	return nil
+}
+
+func (s *recordingSink) next(t *testing.T) []Event {
+	t.Helper()
+	select {
+	case batch := <-s.batches:
+		return batch
+	case <-time.After(2 * time.Second):
+		t.Fatal("no batch sent")
+		return nil
+	}
+}
+
+func (s *recordingSink) none(t *testing.T) {
+	t.Helper()
+	select {
+	case batch := <-s.batches:
+		t.Fatalf("unexpected batch %v", batch)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// Waits until the dispatcher has taken every queued event
+func drained(t *testing.T, d *dispatcher) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(d.events) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("queue not drained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func titles(events []Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, e.Title)
+	}
+	return out
+}
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(2, time.Minute)
+	steps := []struct {
+		at   time.Duration
+		want bool
+	}{
+		{0, true},
+		{0, true},
+		{time.Second, false},
+		{30 * time.Second, true}, //One token back after half the period
+		{30 * time.Second, false},
+		{10 * time.Second, false}, //Out of order times never refill
+		{5 * time.Minute, true},   //Refill is capped at capacity
+		{5 * time.Minute, true},
+		{5 * time.Minute, false},
+	}
+	for i, step := range steps {
+		if got := l.allow(start.Add(step.at)); got != step.want {
+			t.Errorf("step %d at %v: allow = %v, want %v", i, step.at, got, step.want)
+		}
+	}
+}
+
+func TestDispatcherRateLimit(t *testing.T) {
+	clock := newFakeClock()
+	sink := newRecordingSink()
+	n := &Notifier{clock: clock}
+	n.dispatchers = []*dispatcher{newDispatcher(sink, SinkConfig{RateLimit: 2}, Info, clock)}
+	defer n.Close()
+
+	n.Notify(Event{Severity: Info, Title: "a"})
+	if got := titles(sink.next(t)); len(got) != 1 || got[0] != "a" {
+		t.Errorf("first batch = %v", got)
+	}
+	n.Notify(Event{Severity: Info, Title: "b"})
+	if got := titles(sink.next(t)); len(got) != 1 || got[0] != "b" {
+		t.Errorf("second batch = %v", got)
+	}
+	n.Notify(Event{Severity: Info, Title: "c"}) //Over the limit
+	sink.none(t)
+
+	//Critical always passes; the drop is reported with the next batch
+	n.Notify(Event{Severity: Critical, Title: "urgent"})
+	batch := sink.next(t)
+	if len(batch) != 2 || batch[0].Title != "urgent" || batch[1].Kind != KindSuppressed || batch[1].Title != "1 notifications suppressed by rate limit" {
+		t.Fatalf("third batch = %+v", batch)
+	}
+	if !batch[1].Time.Equal(clock.Now()) {
+		t.Errorf("suppressed notice at %v, want %v", batch[1].Time, clock.Now())
+	}
+
+	clock.Advance(30 * time.Second)
+	n.Notify(Event{Severity: Info, Title: "d"})
+	if got := titles(sink.next(t)); len(got) != 1 || got[0] != "d" {
+		t.Errorf("batch after refill = %v", got)
+	}
+}
+
+func TestDispatcherSeverityFilter(t *testing.T) {
+	clock := newFakeClock()
+	sink := newRecordingSink()
+	d := newDispatcher(sink, SinkConfig{}, Warning, clock)
+	d.offer(Event{Severity: Info, Title: "quiet", Time: clock.Now()})
+	d.offer(Event{Severity: Warning, Title: "loud", Time: clock.Now()})
+	close(d.events)
+	<-d.done
+	if got := titles(sink.next(t)); len(got) != 1 || got[0] != "loud" {
+		t.Errorf("batch = %v", got)
+	}
+	sink.none(t)
+}
+
+func TestDispatcherBatchWindow(t *testing.T) {
+	clock := newFakeClock()
+	sink := newRecordingSink()
+	d := newDispatcher(sink, SinkConfig{BatchSize: 3, BatchWindow: 5}, Info, clock)
+
+	//A partial batch waits for the window
+	d.offer(Event{Title: "a", Time: clock.Now()})
+	<-clock.waiting
+	d.offer(Event{Title: "b", Time: clock.Now()})
+	drained(t, d)
+	sink.none(t)
+	clock.Advance(4 * time.Second)
+	sink.none(t)
+	clock.Advance(time.Second)
+	if got := titles(sink.next(t)); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("windowed batch = %v", got)
+	}
+
+	//A full batch goes out without waiting for the window
+	d.offer(Event{Title: "c", Time: clock.Now()})
+	<-clock.waiting
+	d.offer(Event{Title: "d", Time: clock.Now()})
+	d.offer(Event{Title: "e", Time: clock.Now()})
+	if got := titles(sink.next(t)); len(got) != 3 || got[0] != "c" || got[2] != "e" {
+		t.Errorf("full batch = %v", got)
+	}
+
+	//Closing flushes a waiting batch
+	d.offer(Event{Title: "f", Time: clock.Now()})
+	<-clock.waiting
+	drained(t, d)
+	close(d.events)
+	<-d.done
+	if got := titles(sink.next(t)); len(got) != 1 || got[0] != "f" {
+		t.Errorf("flushed batch = %v", got)
+	}
+}
+
+func TestDispatcherBatchQueued(t *testing.T) {
+	clock := newFakeClock()
+	sink := &blockingSink{recordingSink: newRecordingSink(), release: make(chan struct{})}
+	d := newDispatcher(sink, SinkConfig{BatchSize: 10}, Info, clock)
+
+	//While the sink is busy, events queue up and go out together
+	d.offer(Event{Title: "a", Time: clock.Now()})
+	if got := titles(sink.next(t)); len(got) != 1 {
+		t.Fatalf("first batch = %v", got)
+	}
+	d.offer(Event{Title: "b", Time: clock.Now()})
+	d.offer(Event{Title: "c", Time: clock.Now()})
+	close(sink.release)
+	if got := titles(sink.next(t)); len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("queued batch = %v", got)
+	}
+	close(d.events)
+	<-d.done
+}
+
+// Records a batch, then blocks the first send until released
+type blockingSink struct {
+	*recordingSink
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *blockingSink) Send(events []Event) error {
+	s.recordingSink.Send(events)
+	s.once.Do(func() { <-s.release })
+	return nil
+}
+
+func TestNotifierClosed(t *testing.T) {
+	var nilNotifier *Notifier
+	nilNotifier.Notify(Event{Title: "ignored"})
+	nilNotifier.Close()
+
+	clock := newFakeClock()
+	sink := newRecordingSink()
+	n := &Notifier{clock: clock}
+	n.dispatchers = []*dispatcher{newDispatcher(sink, SinkConfig{}, Info, clock)}
+	n.Notify(Event{Title: "before"})
+	n.Close()
+	n.Notify(Event{Title: "after"})
+	if got := titles(sink.next(t)); len(got) != 1 || got[0] != "before" {
+		t.Errorf("batch = %v", got)
+	}
+	sink.none(t)
+}
@@ -0,0 +1,276 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"robolimited/secret"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings of one sink
+type SinkConfig struct {
+	Type        string  `yaml:"type"`         //webhook, discord, slack, smtp or file
+	MinSeverity string  `yaml:"min_severity"` //info, warning or critical (default info)
+	RateLimit   int     `yaml:"rate_limit"`   //Events per minute before dropping (0 = unlimited, critical always passes)
+	BatchSize   int     `yaml:"batch_size"`   //Events sent together (default 1)
+	BatchWindow float64 `yaml:"batch_window"` //Seconds to wait for a batch to fill (0 = send what is queued)
+
+	URL secret.Secret `yaml:"url"` //webhook, discord, slack (webhook URLs are credentials)
+
+	SMTPAddr    string   `yaml:"smtp_addr"` //host:port
+	From        string   `yaml:"from"`
+	To          []string `yaml:"to"`
+	Username    string   `yaml:"username"`     //Optional SMTP auth
+	PasswordEnv string   `yaml:"password_env"` //Environment variable holding the SMTP password
+
+	Path string `yaml:"path"` //file
+}
+
+// Checks every sink's settings without starting any
+func Validate(configs []SinkConfig) error {
+	var errs []error
+	for i, c := range configs {
+		if _, _, err := c.build(); err != nil {
+			errs = append(errs, fmt.Errorf("[%d] %s: %w", i, c.Type, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c SinkConfig) build() (Sink, Severity, error) {
+	minSeverity, err := ParseSeverity(c.MinSeverity)
+	if err != nil {
+		return nil, Info, err
+	}
+	if c.RateLimit < 0 || c.BatchSize < 0 || c.BatchWindow < 0 {
+		return nil, Info, errors.New("rate_limit, batch_size and batch_window must not be negative")
+	}
+
+	switch c.Type {
+	case "webhook", "discord", "slack":
+		if url := c.URL.Reveal(); !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return nil, Info, errors.New("url must be an http(s) URL")
+		}
+		return &WebhookSink{URL: c.URL, Format: c.Type}, minSeverity, nil
+	case "smtp":
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			return nil, Info, fmt.Errorf("smtp_addr: %w", err)
+		}
+		if c.From == "" || len(c.To) == 0 {
+			return nil, Info, errors.New("from and to are required")
+		}
+		sink := &SMTPSink{Addr: c.SMTPAddr, From: c.From, To: c.To, Username: c.Username}
+		if c.Username != "" {
+			if c.PasswordEnv == "" || os.Getenv(c.PasswordEnv) == "" {
+				return nil, Info, errors.New("username needs password_env naming a set environment variable")
+			}
+			sink.Password = secret.New(os.Getenv(c.PasswordEnv))
+		}
+		return sink, minSeverity, nil
+	case "file":
+		if c.Path == "" {
+			return nil, Info, errors.New("path is required")
+		}
+		return &FileSink{Path: c.Path}, minSeverity, nil
+	default:
+		return nil, Info, fmt.Errorf("unknown sink type %q (want webhook, discord, slack, smtp or file)", c.Type)
+	}
+}
+
+// One-line summary of an event
+func (e Event) String() string {
+	line := "[" + strings.ToUpper(e.Severity.String()) + "] " + e.Title
+	if e.Message != "" {
+		line += ": " + e.Message
+	}
+	return line
+}
+
+// Fields in key order
+func (e Event) sortedFields() []string {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Posts events as JSON: generic ({"events": [...]}), Discord embeds or Slack text
+type WebhookSink struct {
+	URL    secret.Secret
+	Format string //webhook, discord or slack
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Discord accepts at most this many embeds per message
+const discordMaxEmbeds = 10
+
+func (s *WebhookSink) Name() string {
+	return s.Format
+}
+
+func (s *WebhookSink) Send(events []Event) error {
+	switch s.Format {
+	case "discord":
+		for start := 0; start < len(events); start += discordMaxEmbeds {
+			if err := s.post(discordPayload(events[start:min(start+discordMaxEmbeds, len(events))])); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "slack":
+		return s.post(slackPayload(events))
+	default:
+		return s.post(map[string]any{"events": events})
+	}
+}
+
+func (s *WebhookSink) post(payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(s.URL.Reveal(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		//Drop the URL from the error so it never reaches the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("webhook post: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("webhook returned %d: %s", resp.StatusCode, snippet)
+	}
+	return nil
+}
+
+// Embed colors by severity
+var discordColors = map[Severity]int{Info: 0x2e7d32, Warning: 0xf9a825, Critical: 0xc62828}
+
+func discordPayload(events []Event) map[string]any {
+	embeds := make([]map[string]any, 0, len(events))
+	for _, e := range events {
+		embed := map[string]any{
+			"title":       "[" + strings.ToUpper(e.Severity.String()) + "] " + e.Title,
+			"description": e.Message,
+			"color":       discordColors[e.Severity],
+			"timestamp":   e.Time.Format(time.RFC3339),
+		}
+		var fields []map[string]any
+		for _, key := range e.sortedFields() {
+			fields = append(fields, map[string]any{"name": key, "value": e.Fields[key], "inline": true})
+		}
+		if len(fields) > 0 {
+			embed["fields"] = fields
+		}
+		embeds = append(embeds, embed)
+	}
+	return map[string]any{"embeds": embeds}
+}
+
+func slackPayload(events []Event) map[string]any {
+	lines := make([]string, 0, len(events))
+	for _, e := range events {
+		line := "*[" + strings.ToUpper(e.Severity.String()) + "] " + e.Title + "*"
+		if e.Message != "" {
+			line += "\n" + e.Message
+		}
+		for _, key := range e.sortedFields() {
+			line += "\n• " + key + ": " + e.Fields[key]
+		}
+		lines = append(lines, line)
+	}
+	return map[string]any{"text": strings.Join(lines, "\n\n")}
+}
+
+// Emails each batch as one plain-text message
+type SMTPSink struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password secret.Secret
+}
+
+func (s *SMTPSink) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPSink) Send(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	subject := "[RoboLimited] " + events[0].String()
+	if len(events) > 1 {
+		subject = fmt.Sprintf("[RoboLimited] %d notifications", len(events))
+	}
+	var body strings.Builder
+	for _, e := range events {
+		body.WriteString(e.Time.Format(time.DateTime) + " " + e.String() + "\r\n")
+		for _, key := range e.sortedFields() {
+			body.WriteString("    " + key + ": " + e.Fields[key] + "\r\n")
+		}
+		body.WriteString("\r\n")
+	}
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + strings.Join(s.To, ", ") + "\r\n" +
+		"Subject: " + strings.NewReplacer("\r", " ", "\n", " ").Replace(subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body.String()
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password.Reveal(), host)
+	}
+	return smtp.SendMail(s.Addr, auth, s.From, s.To, []byte(msg))
+}
+
+// Appends events as JSON lines to a local file
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Send(events []Event) error {
+	var buf bytes.Buffer
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,352 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"robolimited/secret"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var testTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testEvents(n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = Event{
+			Kind:     KindPurchase,
+			Severity: Severity(i % 3),
+			Time:     testTime,
+			Title:    fmt.Sprintf("event %d", i),
+			Message:  "details",
+			Fields:   map[string]string{"price": "100", "item": "42"},
+		}
+	}
+	return events
+}
+
+// Local webhook receiver keeping every decoded body
+type webhookReceiver struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []map[string]any
+	status int
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	r := &webhookReceiver{status: http.StatusNoContent}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q", req.Method, req.Header.Get("Content-Type"))
+		}
+		var body map[string]any
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+		r.mu.Lock()
+		r.bodies = append(r.bodies, body)
+		status := r.status
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, "receiver says no")
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) sink(t *testing.T, format string) Sink {
+	t.Helper()
+	sink, _, err := SinkConfig{Type: format, URL: secret.New(r.URL + "/hook")}.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+func TestWebhookSink(t *testing.T) {
+	r := newWebhookReceiver(t)
+	if err := r.sink(t, "webhook").Send(testEvents(2)); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := r.bodies[0]["events"].([]any)
+	if len(r.bodies) != 1 || len(events) != 2 {
+		t.Fatalf("bodies = %v", r.bodies)
+	}
+	first := events[0].(map[string]any)
+	if first["kind"] != "purchase" || first["severity"] != "info" || first["title"] != "event 0" || first["time"] != testTime.Format(time.RFC3339) {
+		t.Errorf("event = %v", first)
+	}
+	if events[1].(map[string]any)["severity"] != "warning" {
+		t.Errorf("severity = %v, want warning", events[1])
+	}
+}
+
+func TestDiscordSink(t *testing.T) {
+	r := newWebhookReceiver(t)
+	if err := r.sink(t, "discord").Send(testEvents(discordMaxEmbeds + 2)); err != nil {
+		t.Fatal(err)
+	}
+	//Split into messages of at most ten embeds
+	if len(r.bodies) != 2 {
+		t.Fatalf("got %d posts, want 2", len(r.bodies))
+	}
+	first, _ := r.bodies[0]["embeds"].([]any)
+	second, _ := r.bodies[1]["embeds"].([]any)
+	if len(first) != discordMaxEmbeds || len(second) != 2 {
+		t.Fatalf("embeds per post = %d, %d", len(first), len(second))
+	}
+	embed := first[2].(map[string]any)
+	if embed["title"] != "[CRITICAL] event 2" || embed["description"] != "details" || embed["color"] != float64(discordColors[Critical]) {
+		t.Errorf("embed = %v", embed)
+	}
+	fields, _ := embed["fields"].([]any)
+	if len(fields) != 2 || fields[0].(map[string]any)["name"] != "item" || fields[1].(map[string]any)["value"] != "100" {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestSlackSink(t *testing.T) {
+	r := newWebhookReceiver(t)
+	if err := r.sink(t, "slack").Send(testEvents(2)); err != nil {
+		t.Fatal(err)
+	}
+	want := "*[INFO] event 0*\ndetails\n• item: 42\n• price: 100\n\n*[WARNING] event 1*\ndetails\n• item: 42\n• price: 100"
+	if len(r.bodies) != 1 || r.bodies[0]["text"] != want {
+		t.Errorf("text = %q, want %q", r.bodies[0]["text"], want)
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	r := newWebhookReceiver(t)
+	r.status = http.StatusBadRequest
+	err := r.sink(t, "webhook").Send(testEvents(1))
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "receiver says no") {
+		t.Errorf("error = %v, want status and body", err)
+	}
+
+	//Connection errors must not leak the webhook URL
+	closed := httptest.NewServer(http.NotFoundHandler())
+	url := closed.URL + "/api/webhooks/123/token"
+	closed.Close()
+	sink, _, _ := SinkConfig{Type: "discord", URL: secret.New(url)}.build()
+	err = sink.Send(testEvents(1))
+	if err == nil || strings.Contains(err.Error(), "token") {
+		t.Errorf("error = %v, want one without the URL", err)
+	}
+}
+
+// Local SMTP stand-in accepting one message per connection
+type smtpStandIn struct {
+	addr     string
+	messages chan smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpStandIn{addr: ln.Addr().String(), messages: make(chan smtpMessage, 4)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP stand-in")
+	var msg smtpMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			msg.from = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(cmd[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 end with .")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			msg.data = data.String()
+			s.messages <- msg
+			msg = smtpMessage{}
+			reply("250 queued")
+		case upper == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPSink(t *testing.T) {
+	server := newSMTPStandIn(t)
+	sink, _, err := SinkConfig{Type: "smtp", SMTPAddr: server.addr, From: "bot@localhost", To: []string{"me@example.com", "you@example.com"}}.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Send(testEvents(1)); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-server.messages
+	if msg.from != "bot@localhost" || len(msg.to) != 2 || msg.to[1] != "you@example.com" {
+		t.Errorf("envelope = %q to %q", msg.from, msg.to)
+	}
+	for _, want := range []string{"Subject: [RoboLimited] [INFO] event 0: details\r\n", "To: me@example.com, you@example.com\r\n", "2026-01-02 03:04:05 [INFO] event 0: details\r\n", "    price: 100\r\n"} {
+		if !strings.Contains(msg.data, want) {
+			t.Errorf("message missing %q:\n%s", want, msg.data)
+		}
+	}
+
+	//Batches share one message
+	if err := sink.Send(testEvents(3)); err != nil {
+		t.Fatal(err)
+	}
+	msg = <-server.messages
+	if !strings.Contains(msg.data, "Subject: [RoboLimited] 3 notifications\r\n") || !strings.Contains(msg.data, "[CRITICAL] event 2") {
+		t.Errorf("batched message:\n%s", msg.data)
+	}
+
+	//Nothing to send opens no connection
+	if err := sink.Send(nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-server.messages:
+		t.Errorf("unexpected message %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink := &FileSink{Path: path}
+	if err := sink.Send(testEvents(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(testEvents(1)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil || e.Title != "event 1" || e.Severity != Warning {
+		t.Errorf("line = %s (%v)", lines[1], err)
+	}
+}
+
+func TestSinkConfigSecrets(t *testing.T) {
+	const hook = "https://discord.com/api/webhooks/123/very-secret-token"
+	var configs []SinkConfig
+	if err := yaml.Unmarshal([]byte("- type: discord\n  url: "+hook+"\n"), &configs); err != nil {
+		t.Fatal(err)
+	}
+	if configs[0].URL.Reveal() != hook {
+		t.Fatalf("url = %q, want %q", configs[0].URL.Reveal(), hook)
+	}
+	if err := Validate(configs); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if printed := fmt.Sprintf("%v %+v", configs, configs); strings.Contains(string(out), "very-secret-token") || strings.Contains(printed, "very-secret-token") || !strings.Contains(printed, "[REDACTED]") {
+		t.Errorf("secret leaked: %s / %v", out, configs)
+	}
+
+	//Errors about a bad URL must not echo it
+	err = Validate([]SinkConfig{{Type: "slack", URL: secret.New("ftp://hooks.slack.com/very-secret-token")}})
+	if err == nil || strings.Contains(err.Error(), "very-secret-token") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Setenv("NOTIFY_TEST_PASSWORD", "hunter2")
+	tests := []struct {
+		name   string
+		config SinkConfig
+		reason string //Empty if valid
+	}{
+		{"file", SinkConfig{Type: "file", Path: "x.jsonl"}, ""},
+		{"file without path", SinkConfig{Type: "file"}, "path is required"},
+		{"unknown type", SinkConfig{Type: "pager"}, "unknown sink type"},
+		{"bad severity", SinkConfig{Type: "file", Path: "x", MinSeverity: "loud"}, "unknown severity"},
+		{"negative rate", SinkConfig{Type: "file", Path: "x", RateLimit: -1}, "must not be negative"},
+		{"webhook without url", SinkConfig{Type: "webhook"}, "http(s) URL"},
+		{"smtp", SinkConfig{Type: "smtp", SMTPAddr: "localhost:25", From: "a@b", To: []string{"c@d"}}, ""},
+		{"smtp without port", SinkConfig{Type: "smtp", SMTPAddr: "localhost", From: "a@b", To: []string{"c@d"}}, "smtp_addr"},
+		{"smtp without recipients", SinkConfig{Type: "smtp", SMTPAddr: "localhost:25", From: "a@b"}, "from and to are required"},
+		{"smtp auth", SinkConfig{Type: "smtp", SMTPAddr: "localhost:25", From: "a@b", To: []string{"c@d"}, Username: "me", PasswordEnv: "NOTIFY_TEST_PASSWORD"}, ""},
+		{"smtp auth without password", SinkConfig{Type: "smtp", SMTPAddr: "localhost:25", From: "a@b", To: []string{"c@d"}, Username: "me", PasswordEnv: "NOTIFY_TEST_UNSET"}, "password_env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]SinkConfig{tt.config})
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("error = %v, want %q", err, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"robolimited/tools"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+Tracks live purchase orders from intent to fill and reconciles them against the
+account inventory, so pending or lost purchases are confirmed or failed.
+*/
+
+var orders *tools.OrderStore
+
+// Latest inventory snapshot (asset id -> copies), nil before the first reconcile
+var holdings map[string]int
+var holdingsMu sync.Mutex
+
+// Copies of an item in the latest inventory snapshot (-1 if no snapshot yet)
+func heldCopies(id string) int {
+	holdingsMu.Lock()
+	defer holdingsMu.Unlock()
+	if holdings == nil {
+		return -1
+	}
+	return holdings[id]
+}
+
+// Live copies of an item counted against max_lots: those in the latest inventory snapshot
+// plus orders not yet resolved (a fill is only confirmed once it is in the snapshot)
+func liveLots(id string) int {
+	lots := max(heldCopies(id), 0)
+	for _, o := range orders.All() {
+		if o.AssetID == id && !o.State.Final() {
+			lots++
+		}
+	}
+	return lots
+}
+
+// Records the intent to buy a listing
+func openOrder(id string, collectibleItemId string, listing tools.ResellerResponse, idempotencyKey string) *tools.Order {
+	order := orders.Create(tools.Order{
+		ID:                idempotencyKey,
+		AssetID:           id,
+		CollectibleItemID: collectibleItemId,
+		InstanceID:        listing.CollectibleItemInstanceID,
+		Price:             listing.Price,
+		Serial:            listing.SerialNumber,
+		HeldBefore:        heldCopies(id),
+	}, time.Now())
+	transitionOrder(order.ID, tools.OrderSubmitted, "")
+	return order
+}
+
+// Moves an order to the state implied by the purchase response
+func recordOutcome(order *tools.Order, result purchaseResponse, err error) {
+	switch {
+	case errors.Is(err, errNoResponse):
+		transitionOrder(order.ID, tools.OrderUnknown, err.Error())
+	case err != nil:
+		transitionOrder(order.ID, tools.OrderFailed, err.Error())
+	case result.Pending:
+		transitionOrder(order.ID, tools.OrderPending, "pending at Roblox")
+	case result.Purchased:
+		transitionOrder(order.ID, tools.OrderPending, "accepted, awaiting inventory")
+	default:
+		reason := result.PurchaseResult
+		if result.ErrorMessage != nil {
+			reason = *result.ErrorMessage
+		}
+		transitionOrder(order.ID, tools.OrderFailed, "not purchased: "+reason)
+	}
+}
+
+func transitionOrder(id string, state tools.OrderState, note string) {
+	if err := orders.Transition(id, state, note, time.Now()); err != nil {
+		log.Println(err)
+	}
+}
+
+// Fetches inventory and resolves open orders against it
+func reconcileOrders() error {
+	_, _, err := reconcileInventory()
+	return err
+}
+
+// Fetches inventory (item id -> UAIDs), resolves open orders and matches ledger entries to held copies
+func reconcileInventory() (map[string][]int64, tools.LedgerSync, error) {
+	inventory, err := tools.FetchInventoryUAIDs(strconv.FormatInt(settings.RobloxId, 10))
+	if err != nil {
+		return nil, tools.LedgerSync{}, err
+	}
+	counts := make(map[string]int, len(inventory))
+	for id, uaids := range inventory {
+		counts[id] = len(uaids)
+	}
+
+	holdingsMu.Lock()
+	holdings = counts
+	holdingsMu.Unlock()
+
+	if changed := orders.Reconcile(counts, time.Now(), time.Duration(settings.OrderTimeout)*time.Second); changed > 0 {
+		log.Println("Reconciled", changed, "orders |", orders.Summary())
+	}
+
+	//Filled orders are real acquisitions
+	if added := ledger.AddFromOrders(orders.All()); added > 0 {
+		log.Println("Added", added, "filled orders to the ledger")
+	}
+	return inventory, ledger.Sync(inventory), nil
+}
+
+// Reconciles orders on an interval until ctx is cancelled
+func runReconciler(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(settings.ReconcileInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := reconcileOrders(); err != nil {
+			log.Println("Could not reconcile orders:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prints order history as recorded, newest last (optionally for one item)
+// Read-only: the running monitor owns the order file and reconciles it
+func showOrders(itemId string, limit int) {
+	var shown []tools.Order
+	for _, order := range orders.All() {
+		if itemId == "" || order.AssetID == itemId {
+			shown = append(shown, order)
+		}
+	}
+	if limit > 0 && len(shown) > limit {
+		shown = shown[len(shown)-limit:]
+	}
+
+	//Name items where Rolimons data is available
+	itemDetails := tools.GetLimitedData()
+
+	fmt.Println("____________________________________________________")
+	for _, order := range shown {
+		line := order.String()
+		if itemDetails != nil && len(itemDetails.Items[order.AssetID]) > 0 {
+			line += " | " + fmt.Sprint(itemDetails.Items[order.AssetID][0])
+		}
+		fmt.Println(line)
+		for _, event := range order.History {
+			fmt.Println("   ", event.Time.Format(time.DateTime), event.State, event.Note)
+		}
+	}
+	fmt.Println("____________________________________________________")
+	fmt.Println(orders.Summary())
+}
@@ -0,0 +1,219 @@
+package parser
+
+/*
+Parses the embedded JS data objects (var name = {...};) out of Rolimons item pages.
+Validates required fields and array lengths so page format changes surface as
+errors naming the variable and field at fault instead of silently empty data.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"robolimited/config"
+	"robolimited/tools"
+	"sort"
+)
+
+// Page variables the analyzer depends on
+const (
+	SalesVar  = "sales_data"
+	CopiesVar = "bc_copies_data"
+)
+
+// Describes where and how an item page deviated from the expected format
+type FormatError struct {
+	Var    string //Embedded JS variable name
+	Field  string //Offending field (empty when the variable itself is at fault)
+	Reason string
+}
+
+func (e *FormatError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", e.Var, e.Reason)
+	}
+	return fmt.Sprintf("%s.%s: %s", e.Var, e.Field, e.Reason)
+}
+
+// All JSON data objects embedded in an item page, keyed by variable name
+type ItemPage struct {
+	Vars    map[string]json.RawMessage
+	Invalid []string //Variables found but not valid JSON (plain JS literals)
+}
+
+// Owner copies of an item (parallel arrays, one entry per copy)
+type Copies struct {
+	OwnerIDs   []int64 `json:"owner_ids"`
+	LastOnline []int64 `json:"bc_last_online"`
+}
+
+var varDecl = regexp.MustCompile(`var\s+([A-Za-z_$][\w$]*)\s*=\s*([\{\[])`)
+
+// Extracts every embedded object/array variable from page HTML
+func Parse(html string) *ItemPage {
+	page := &ItemPage{Vars: make(map[string]json.RawMessage)}
+	for _, loc := range varDecl.FindAllStringSubmatchIndex(html, -1) {
+		name := html[loc[2]:loc[3]]
+		end := matchBracket(html, loc[4])
+		if end < 0 {
+			page.Invalid = append(page.Invalid, name)
+			continue
+		}
+		raw := html[loc[4] : end+1]
+		if !json.Valid([]byte(raw)) {
+			page.Invalid = append(page.Invalid, name)
+			continue
+		}
+		page.Vars[name] = json.RawMessage(raw)
+	}
+	return page
+}
+
+// Fetches and parses the live Rolimons page of an item
+func FetchItemPage(id string) (*ItemPage, error) {
+	html, err := tools.GetPageSource(fmt.Sprintf(config.RolimonsSite, id))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(html), nil
+}
+
+// Sorted names of all parsed variables
+func (p *ItemPage) Names() []string {
+	names := make([]string, 0, len(p.Vars))
+	for name := range p.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decodes sales_data, requiring every series to be present and equally long
+func (p *ItemPage) Sales() (*tools.Sales, error) {
+	fields, err := p.object(SalesVar, "num_points", "timestamp", "avg_daily_sales_price", "sales_volume")
+	if err != nil {
+		return nil, err
+	}
+
+	var sales tools.Sales
+	if err := decodeField(SalesVar, "timestamp", fields, &sales.Timestamp); err != nil {
+		return nil, err
+	}
+	if err := decodeField(SalesVar, "avg_daily_sales_price", fields, &sales.AvgDailySalesPrice); err != nil {
+		return nil, err
+	}
+	if err := decodeField(SalesVar, "sales_volume", fields, &sales.SalesVolume); err != nil {
+		return nil, err
+	}
+	if err := decodeField(SalesVar, "num_points", fields, &sales.NumPoints); err != nil {
+		return nil, err
+	}
+
+	n := len(sales.Timestamp)
+	if len(sales.AvgDailySalesPrice) != n {
+		return nil, lengthError(SalesVar, "avg_daily_sales_price", len(sales.AvgDailySalesPrice), "timestamp", n)
+	}
+	if len(sales.SalesVolume) != n {
+		return nil, lengthError(SalesVar, "sales_volume", len(sales.SalesVolume), "timestamp", n)
+	}
+	if sales.NumPoints != n {
+		return nil, &FormatError{Var: SalesVar, Field: "num_points", Reason: fmt.Sprintf("is %d but series have %d points", sales.NumPoints, n)}
+	}
+	return &sales, nil
+}
+
+// Decodes bc_copies_data, requiring owner and last-online arrays of equal length
+func (p *ItemPage) Copies() (*Copies, error) {
+	fields, err := p.object(CopiesVar, "owner_ids", "bc_last_online")
+	if err != nil {
+		return nil, err
+	}
+
+	var copies Copies
+	if err := decodeField(CopiesVar, "owner_ids", fields, &copies.OwnerIDs); err != nil {
+		return nil, err
+	}
+	if err := decodeField(CopiesVar, "bc_last_online", fields, &copies.LastOnline); err != nil {
+		return nil, err
+	}
+	if len(copies.LastOnline) != len(copies.OwnerIDs) {
+		return nil, lengthError(CopiesVar, "bc_last_online", len(copies.LastOnline), "owner_ids", len(copies.OwnerIDs))
+	}
+	return &copies, nil
+}
+
+// Runs every validator and returns all format errors found
+func (p *ItemPage) Validate() []error {
+	var errs []error
+	if _, err := p.Sales(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := p.Copies(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Looks up a variable as a JSON object and checks that required fields exist
+func (p *ItemPage) object(name string, required ...string) (map[string]json.RawMessage, error) {
+	raw, ok := p.Vars[name]
+	if !ok {
+		for _, invalid := range p.Invalid {
+			if invalid == name {
+				return nil, &FormatError{Var: name, Reason: "found but not valid JSON"}
+			}
+		}
+		return nil, &FormatError{Var: name, Reason: "missing from page"}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, &FormatError{Var: name, Reason: "not a JSON object"}
+	}
+	for _, field := range required {
+		if _, ok := fields[field]; !ok {
+			return nil, &FormatError{Var: name, Field: field, Reason: "required field missing"}
+		}
+	}
+	return fields, nil
+}
+
+func decodeField(name string, field string, fields map[string]json.RawMessage, dst any) error {
+	if err := json.Unmarshal(fields[field], dst); err != nil {
+		return &FormatError{Var: name, Field: field, Reason: fmt.Sprintf("unexpected type: %v", err)}
+	}
+	return nil
+}
+
+func lengthError(name string, field string, n int, refField string, refN int) error {
+	return &FormatError{Var: name, Field: field, Reason: fmt.Sprintf("length %d does not match %s length %d", n, refField, refN)}
+}
+
+// Returns index of the bracket closing the one at open, skipping over JS strings
+func matchBracket(src string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(src); i++ {
+		c := src[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func loadFixture(t *testing.T, name string) *ItemPage {
+	t.Helper()
+	html, err := os.ReadFile("../data/fixtures/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Parse(string(html))
+}
+
+func TestParseFixture(t *testing.T) {
+	page := loadFixture(t, "rolimons_item.html")
+
+	if got, want := page.Names(), []string{"bc_copies_data", "item_details_data", "sales_data"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+	if got, want := page.Invalid, []string{"chart_settings"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Invalid = %v, want %v", got, want)
+	}
+
+	sales, err := page.Sales()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sales.NumPoints != 8 || len(sales.Timestamp) != 8 || sales.Timestamp[0] != 1762000000 || sales.AvgDailySalesPrice[7] != 412 || sales.SalesVolume[4] != 6 {
+		t.Errorf("Sales() = %+v", sales)
+	}
+
+	copies, err := page.Copies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1001, 1002, 1001, 1003, 1004, 1001}; !reflect.DeepEqual(copies.OwnerIDs, want) {
+		t.Errorf("OwnerIDs = %v, want %v", copies.OwnerIDs, want)
+	}
+	if len(copies.LastOnline) != len(copies.OwnerIDs) {
+		t.Errorf("LastOnline has %d entries, want %d", len(copies.LastOnline), len(copies.OwnerIDs))
+	}
+
+	if errs := page.Validate(); len(errs) != 0 {
+		t.Errorf("Validate() = %v, want no errors", errs)
+	}
+}
+
+func TestParseBrokenPages(t *testing.T) {
+	tests := []struct {
+		name       string
+		page       func(t *testing.T) *ItemPage
+		wantSales  *FormatError //nil if sales_data should decode
+		wantCopies *FormatError //nil if bc_copies_data should decode
+	}{
+		{
+			name:      "missing var",
+			page:      func(t *testing.T) *ItemPage { return loadFixture(t, "rolimons_item_missing_var.html") },
+			wantSales: &FormatError{Var: SalesVar, Reason: "missing from page"},
+		},
+		{
+			name:       "mismatched array lengths",
+			page:       func(t *testing.T) *ItemPage { return loadFixture(t, "rolimons_item_length_mismatch.html") },
+			wantSales:  &FormatError{Var: SalesVar, Field: "avg_daily_sales_price", Reason: "length 7 does not match timestamp length 8"},
+			wantCopies: &FormatError{Var: CopiesVar, Field: "bc_last_online", Reason: "length 5 does not match owner_ids length 6"},
+		},
+		{
+			name: "invalid JSON",
+			page: func(t *testing.T) *ItemPage {
+				return Parse(`var sales_data = {num_points: 1}; var bc_copies_data = {"owner_ids": [1], "bc_last_online": [2]};`)
+			},
+			wantSales: &FormatError{Var: SalesVar, Reason: "found but not valid JSON"},
+		},
+		{
+			name: "required field missing",
+			page: func(t *testing.T) *ItemPage {
+				return Parse(`var sales_data = {"num_points": 0, "timestamp": [], "avg_daily_sales_price": []}; var bc_copies_data = {"owner_ids": []};`)
+			},
+			wantSales:  &FormatError{Var: SalesVar, Field: "sales_volume", Reason: "required field missing"},
+			wantCopies: &FormatError{Var: CopiesVar, Field: "bc_last_online", Reason: "required field missing"},
+		},
+		{
+			name: "num_points disagrees with series",
+			page: func(t *testing.T) *ItemPage {
+				return Parse(`var sales_data = {"num_points": 3, "timestamp": [1], "avg_daily_sales_price": [2], "sales_volume": [3]}; var bc_copies_data = {"owner_ids": [], "bc_last_online": []};`)
+			},
+			wantSales: &FormatError{Var: SalesVar, Field: "num_points", Reason: "is 3 but series have 1 points"},
+		},
+		{
+			name: "not an object",
+			page: func(t *testing.T) *ItemPage {
+				return Parse(`var sales_data = [1, 2]; var bc_copies_data = {"owner_ids": [], "bc_last_online": []};`)
+			},
+			wantSales: &FormatError{Var: SalesVar, Reason: "not a JSON object"},
+		},
+		{
+			name: "unterminated object",
+			page: func(t *testing.T) *ItemPage {
+				return Parse(`var bc_copies_data = {"owner_ids": [], "bc_last_online": []}; var sales_data = {"num_points": 1, "timestamp": [`)
+			},
+			wantSales: &FormatError{Var: SalesVar, Reason: "found but not valid JSON"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := tt.page(t)
+			_, err := page.Sales()
+			checkFormatError(t, "Sales()", err, tt.wantSales)
+			_, err = page.Copies()
+			checkFormatError(t, "Copies()", err, tt.wantCopies)
+
+			want := 0
+			if tt.wantSales != nil {
+				want++
+			}
+			if tt.wantCopies != nil {
+				want++
+			}
+			if errs := page.Validate(); len(errs) != want {
+				t.Errorf("Validate() = %v, want %d errors", errs, want)
+			}
+		})
+	}
+}
+
+func checkFormatError(t *testing.T, call string, err error, want *FormatError) {
+	t.Helper()
+	if want == nil {
+		if err != nil {
+			t.Errorf("%s error = %v, want nil", call, err)
+		}
+		return
+	}
+	var got *FormatError
+	if !errors.As(err, &got) {
+		t.Fatalf("%s error = %v, want %v", call, err, want)
+	}
+	if *got != *want {
+		t.Errorf("%s error = %q, want %q", call, got, want)
+	}
+}
+
+func TestMatchBracket(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{`{}`, 1},
+		{`{"a": [1, {"b": 2}]}`, 19},
+		{`{"s": "}; not the end"}`, 22},
+		{`{'s': '\'}'}`, 11},
+		{`{"a": [1, 2}`, -1},
+	}
+	for _, tt := range tests {
+		if got := matchBracket(tt.src, 0); got != tt.want {
+			t.Errorf("matchBracket(%q) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
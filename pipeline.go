@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"robolimited/config"
+	"robolimited/tools"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Monitor pipeline: a poller feeds deals to a pool of deciders, which queue buys for a
+single executor. Stages are joined by bounded channels. Stale deals are dropped when
+the deciders fall behind; deciders wait when the executor queue is full.
+*/
+
+// Counters for one pipeline stage
+type stageMetrics struct {
+	name      string
+	processed atomic.Int64
+	dropped   atomic.Int64
+	busy      atomic.Int64 //Nanoseconds spent working
+}
+
+func (m *stageMetrics) track(start time.Time) {
+	m.processed.Add(1)
+	m.busy.Add(int64(time.Since(start)))
+}
+
+func (m *stageMetrics) String() string {
+	return fmt.Sprintf("Stage %s | Processed: %d | Dropped: %d | Busy: %s",
+		m.name, m.processed.Load(), m.dropped.Load(), time.Duration(m.busy.Load()).Round(time.Millisecond))
+}
+
+// Deal that passed the poller's filters, waiting for strategy decisions
+type dealTask struct {
+	event  DealEvent
+	market *MarketContext
+	trace  *tools.StepTimer //Started at the deal's activity time
+}
+
+// Buy decision waiting for execution
+type buyOrder struct {
+	runner   int //Index into pipeline runners
+	event    DealEvent
+	market   *MarketContext
+	decision Decision
+	trace    *tools.StepTimer //Set on the first strategy's buys only
+}
+
+type pipeline struct {
+	settings  *config.Settings
+	liveMoney bool
+	runners   []strategyRunner
+	watchlist *tools.WatchlistFile
+	tracker   *tools.ActivityTracker
+
+	deals  chan dealTask
+	orders chan buyOrder
+
+	poller, decider, executor stageMetrics
+
+	simMu       sync.Mutex //Guards runner ledgers written by the executor and paper exits
+	itemDetails atomic.Pointer[tools.ItemDetails]
+	refreshed   atomic.Int64 //Unix nanoseconds of the last item details refresh
+	lastPoll    atomic.Int64 //Unix nanoseconds of the last completed poll
+
+	paused atomic.Bool //Poller skips deals while set
+	halted atomic.Bool //Executor drops every order once set (kill switch)
+
+	lastShadow shadowCache //Executor only
+	exiting    atomic.Bool //Paper exit pass running
+}
+
+func newPipeline(s *config.Settings, liveMoney bool, runners []strategyRunner, watchlist *tools.WatchlistFile) *pipeline {
+	p := &pipeline{
+		settings:  s,
+		liveMoney: liveMoney,
+		runners:   runners,
+		watchlist: watchlist,
+		tracker:   tools.NewActivityTracker(time.Duration(s.ActivityTTL) * time.Second),
+		deals:     make(chan dealTask, s.DealQueueSize),
+		orders:    make(chan buyOrder, s.OrderQueueSize),
+		poller:    stageMetrics{name: "poller"},
+		decider:   stageMetrics{name: "decider"},
+		executor:  stageMetrics{name: "executor"},
+	}
+	tools.Metrics.OnCollect(p.collectMetrics)
+	return p
+}
+
+/*
+Runs all stages until ctx is cancelled or the iteration budget is spent.
+Shutdown order: poller stops and closes the deal queue, deciders finish queued deals
+and close the order queue, executor drops the remaining orders unbooked.
+*/
+func (p *pipeline) run(ctx context.Context) {
+	var deciders sync.WaitGroup
+	for range p.settings.DecisionWorkers {
+		deciders.Add(1)
+		go func() {
+			defer deciders.Done()
+			p.decide()
+		}()
+	}
+
+	executorDone := make(chan struct{})
+	go func() {
+		defer close(executorDone)
+		p.execute(ctx)
+	}()
+
+	p.poll(ctx)
+	close(p.deals)
+	deciders.Wait()
+	close(p.orders)
+	<-executorDone
+	p.logMetrics()
+}
+
+func (p *pipeline) logMetrics() {
+	log.Println("Activities |", p.tracker.Totals(), "| Tracked:", p.tracker.Len())
+	log.Println(p.poller.String(), "| Queue:", len(p.deals), "/", cap(p.deals))
+	log.Println(p.decider.String(), "| Queue:", len(p.orders), "/", cap(p.orders))
+	log.Println(p.executor.String())
+}
+
+// Updates gauges before a metrics scrape
+func (p *pipeline) collectMetrics() {
+	if refreshed := p.refreshed.Load(); refreshed > 0 {
+		itemDetailsAge.Set(time.Since(time.Unix(0, refreshed)).Seconds())
+	}
+	itemDetails := p.itemDetails.Load()
+
+	p.simMu.Lock()
+	defer p.simMu.Unlock()
+	for _, r := range p.runners {
+		worth := 0
+		for id, lots := range r.sim.Portfolio {
+			for _, lot := range lots {
+				worth += lotWorth(itemDetails, id, lot)
+			}
+		}
+		simPnL.Set(float64(worth+r.sim.RobuxGained-r.sim.RobuxSpent), r.strategy.Name())
+	}
+}
+
+// Current max(RAP, value) of a held lot, or its cost if the item is unknown
+func lotWorth(itemDetails *tools.ItemDetails, id string, lot tools.Lot) int {
+	if itemDetails == nil || len(itemDetails.Items[id]) < 4 {
+		return lot.Price
+	}
+	rap, _ := itemDetails.Items[id][2].(float64)
+	value, _ := itemDetails.Items[id][3].(float64)
+	return int(max(rap, value))
+}
+
+func (p *pipeline) setItemDetails(itemDetails *tools.ItemDetails) {
+	p.itemDetails.Store(itemDetails)
+	p.refreshed.Store(time.Now().UnixNano())
+}
+
+// Poller stage: fetches deals, keeps RAP current and applies cheap filters
+func (p *pipeline) poll(ctx context.Context) {
+	//id -> [item_name, acronym, rap, value, default_value, demand, trend, projected, hyped, rare]
+	itemDetails := tools.GetLimitedData()
+	if itemDetails != nil {
+		p.setItemDetails(itemDetails)
+	}
+
+	RAP_map := map[string]int{}
+
+	for i := range p.settings.TotalIterations {
+
+		//Bind throttle to unix timemark
+		if !throttleMonitor(ctx) {
+			return
+		}
+		if p.paused.Load() {
+			continue
+		}
+		start := time.Now()
+
+		if p.settings.LogConsole {
+			log.Println("____________________________________________________")
+		}
+
+		if i%p.settings.RefreshRate == 0 {
+			//Recalculate RAP / Value and limited data from Rolimon API
+			itemDetailsNew := tools.GetLimitedData()
+			if itemDetailsNew == nil {
+				//Mark errors in updating
+				log.Println("Could not refresh item details..")
+			} else {
+				itemDetails = itemDetailsNew
+				p.setItemDetails(itemDetails)
+			}
+			//Rebuild buy thresholds off the polling path
+			go decisions.Refresh(itemDetails, p.watchlist.Current())
+			if p.settings.PaperExits && !p.liveMoney {
+				go p.paperExits(itemDetails)
+			}
+			if i > 0 {
+				p.logMetrics()
+				p.simMu.Lock()
+				logStrategySummary(p.runners)
+				p.simMu.Unlock()
+				logShadowFills()
+			}
+		}
+
+		if changed, err := p.watchlist.Reload(); err != nil {
+			log.Println("Rejected watchlist update:", err)
+		} else if changed {
+			log.Println("Reloaded watchlist")
+		}
+
+		//[[timestamp, isRAP, id, bestPrice / RAP]]
+		dealDetails := tools.GetDealsData()
+		if dealDetails == nil {
+			continue
+		} //Catch error, wait for resolution
+
+		//Handle each activity once, oldest first
+		activities, counts := p.tracker.Track(dealDetails.Activities, time.Now())
+		activitiesSeen.Add(float64(len(dealDetails.Activities)))
+		activitiesNew.Add(float64(counts.New))
+		if p.settings.LogConsole {
+			log.Println("Activities |", counts)
+		}
+		for _, activity := range activities {
+			p.filter(activity, itemDetails, RAP_map)
+		}
+
+		pollsTotal.Inc()
+		p.lastPoll.Store(time.Now().UnixNano())
+		p.poller.track(start)
+	}
+}
+
+// Applies item filters to one activity and queues surviving deals for the deciders
+func (p *pipeline) filter(activity tools.Activity, itemDetails *tools.ItemDetails, RAP_map map[string]int) {
+	id, price := activity.ID, activity.Price
+
+	//Handle not found error
+	if itemDetails == nil || len(itemDetails.Items[id]) == 0 {
+		return
+	}
+
+	isDemand := int(itemDetails.Items[id][5].(float64)) >= 1
+	projected := int(itemDetails.Items[id][7].(float64))
+
+	//Exclude projected items and erroneous listings
+	if projected != -1 || price < 1 {
+		return
+	}
+	//Exclude blocked, disabled and (in watch-only mode) unlisted items
+	acronym, _ := itemDetails.Items[id][1].(string)
+	rule, allowed := p.watchlist.Current().Lookup(id, acronym)
+	if !allowed {
+		return
+	}
+	//Exclude items out of price range
+	if !(p.settings.PriceRangeLow <= price && price <= p.settings.PriceRangeHigh) {
+		return
+	}
+
+	//Scan for item details
+	name := itemDetails.Items[id][0].(string)
+	value := int(itemDetails.Items[id][3].(float64))
+	_, inMap := RAP_map[id]
+	if !inMap {
+		RAP_map[id] = int(itemDetails.Items[id][2].(float64))
+	}
+
+	//Exclude items out of RAP range
+	if !(p.settings.RAPRangeLow <= RAP_map[id] && RAP_map[id] <= p.settings.RAPRangeHigh) {
+		return
+	}
+
+	if activity.IsRAP { //Updating RAP
+		RAP_map[id] = price
+
+		if p.settings.LogConsole {
+			log.Println("Updated", name, "|", "RAP:", RAP_map[id], "| Value:", value, "| Price: ", price)
+		}
+		return
+	}
+
+	//Updating best price
+	if p.settings.LogConsole {
+		log.Println("Scanned", name, "|", "RAP:", RAP_map[id], "| Value:", value, "| Price: ", price, "| Deal: ", math.Round(float64(max(RAP_map[id], value)-price)/float64(max(RAP_map[id], value))*1000.0)/10.0, "%")
+	}
+
+	//Apply per-item overrides
+	margin := demandMargin(isDemand)
+	if rule.Margin != nil {
+		margin = *rule.Margin
+	}
+	if rule.MaxPrice != nil && price > *rule.MaxPrice {
+		return
+	}
+
+	trace := tools.NewStepTimerAt(time.Unix(activity.Timestamp, 0))
+	trace.Mark("poll")
+
+	task := dealTask{
+		trace: trace,
+		event: DealEvent{Timestamp: activity.Timestamp, ID: id, Price: price},
+		market: &MarketContext{
+			ID:       id,
+			Name:     name,
+			Acronym:  acronym,
+			RAP:      RAP_map[id],
+			Value:    value,
+			IsDemand: isDemand,
+			Details:  itemLevels(itemDetails.Items[id]),
+			Margin:   margin,
+			Rule:     rule,
+		},
+	}
+
+	//Drop the deal rather than stall polling when deciders are behind
+	select {
+	case p.deals <- task:
+	default:
+		p.poller.dropped.Add(1)
+		log.Println("Decision queue full, dropped deal on", name)
+	}
+}
+
+// Decider stage: runs every strategy on a deal and queues buys
+func (p *pipeline) decide() {
+	for task := range p.deals {
+		start := time.Now()
+		task.trace.Mark("queue")
+		var buys []buyOrder
+		for k, r := range p.runners {
+			decision := r.strategy.Decide(task.event, task.market)
+			recentDecisions.add(r.strategy.Name(), task.event, task.market, decision)
+			if p.settings.LogConsole || decision.Buy {
+				log.Println("Strategy", r.strategy.Name(), "| Item:", task.market.Name, "| Buy:", decision.Buy, "| Confidence:", math.Round(decision.Confidence*100)/100, "|", decision.Reason)
+			}
+			if decision.Buy {
+				decisionsTotal.Inc(r.strategy.Name(), "buy")
+				buys = append(buys, buyOrder{runner: k, event: task.event, market: task.market, decision: decision})
+			} else {
+				decisionsTotal.Inc(r.strategy.Name(), "skip")
+			}
+		}
+		task.trace.Mark("decision")
+
+		//The trace follows the first strategy's buy, or ends here
+		if len(buys) > 0 && buys[0].runner == 0 {
+			buys[0].trace = task.trace
+		} else {
+			latencies.Record(tools.NewTrace(task.event.ID, task.event.Price, task.trace, "skip"))
+		}
+		for _, order := range buys {
+			//Waits while the executor queue is full
+			p.orders <- order
+		}
+		p.decider.track(start)
+	}
+}
+
+// Executor stage: buys in queue order (only stage touching ledgers and live purchases)
+func (p *pipeline) execute(ctx context.Context) {
+	for order := range p.orders {
+		start := time.Now()
+		r := p.runners[order.runner]
+		id, name, price := order.event.ID, order.market.Name, order.event.Price
+		if order.trace != nil {
+			order.trace.Mark("order_queue")
+		}
+		if p.halted.Load() {
+			p.executor.dropped.Add(1)
+			p.endOrder(order, "halted")
+			continue
+		}
+		//No purchases once shutdown starts, the reconciler may already have stopped
+		select {
+		case <-ctx.Done():
+			p.executor.dropped.Add(1)
+			p.endOrder(order, "shutdown")
+			continue
+		default:
+		}
+
+		rule := order.market.Rule
+		live := p.liveMoney && order.runner == 0
+		var heldLots int
+		if live {
+			heldLots = liveLots(id)
+		} else {
+			p.simMu.Lock()
+			heldLots = len(r.sim.Portfolio[id])
+			p.simMu.Unlock()
+		}
+		if rule.MaxLots != nil && heldLots >= *rule.MaxLots {
+			p.executor.dropped.Add(1)
+			if p.settings.LogConsole {
+				log.Println("Skipped", name, "| Holding max lots:", *rule.MaxLots)
+			}
+			p.endOrder(order, "max_lots")
+			continue
+		}
+
+		//BUY
+		var serial int64
+		outcome := "simulated"
+		if live {
+			//Only book what was bought, at the listing's price
+			verdict := purchaseVerdict{Decision: order.decision, maxPrice: price, seen: time.Unix(order.event.Timestamp, 0)}
+			if rule.MaxPrice != nil {
+				verdict.maxPrice = min(verdict.maxPrice, *rule.MaxPrice) //Applies to the listing picked, not just the deal
+			}
+			listing, ok := ExecutePurchase(id, verdict, order.trace)
+			if !ok {
+				p.endOrder(order, "failed")
+				p.executor.track(start)
+				continue
+			}
+			outcome = "bought"
+			price, serial = listing.Price, listing.SerialNumber
+		} else if p.settings.ShadowFills {
+			//Only book paper buys a live order could have filled, at the listing's price
+			fill := p.shadowFill(order)
+			if !fill.Filled {
+				p.executor.dropped.Add(1)
+				if fill.Error != "" {
+					p.endOrder(order, "unchecked")
+				} else {
+					p.endOrder(order, "missed")
+				}
+				continue
+			}
+			price, serial = fill.BestPrice, fill.Serial
+		} else {
+			//Fills at the deal price are assumed; the serial comes from the live listings
+			serial = p.paperSerial(order)
+		}
+		p.simMu.Lock()
+		bought := r.sim.BuyItem(id, name, price, serial)
+		p.simMu.Unlock()
+		switch {
+		case live: //Real money left the account even if the simulated ledger holds the item already
+			spendTotal.Add(float64(price), r.strategy.Name(), "live")
+		case bought:
+			spendTotal.Add(float64(price), r.strategy.Name(), "paper")
+		case outcome == "simulated":
+			outcome = "duplicate"
+		}
+		p.endOrder(order, outcome)
+		p.executor.track(start)
+	}
+}
+
+// Counts an order's result and records the latency trace it carries, if any
+func (p *pipeline) endOrder(order buyOrder, outcome string) {
+	purchasesTotal.Inc(p.runners[order.runner].strategy.Name(), outcome)
+	if order.trace != nil {
+		latencies.Record(tools.NewTrace(order.event.ID, order.event.Price, order.trace, outcome))
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"robolimited/tools"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/*
+Portfolio of real holdings: -mode=portfolio reconciles the ledger of acquisitions with
+the account inventory and reports unrealized P&L at RAP, value and forecast price,
+realized P&L from sales and trades, and the ledger's valuation over past runs.
+*/
+
+var ledger *tools.Ledger
+
+// Prices an open lot is marked at
+type portfolioMarks struct {
+	name     string
+	rap      int
+	value    int //RAP for items without a value
+	forecast int //RAP without a forecast
+}
+
+// Loads the ledger of real acquisitions for the modes that read it
+// Cost basis can't be rebuilt, so an unreadable ledger stops those modes until it is fixed
+func loadLedger() error {
+	var err error
+	ledger, err = tools.LoadLedger(settings.LedgerFile)
+	if err != nil {
+		return fmt.Errorf("could not load ledger: %w", err)
+	}
+	return nil
+}
+
+// Imports importFile (if set), reconciles the ledger and prints the portfolio report
+func showPortfolio(importFile string, daysPast int64, daysFuture int64, limit int) {
+	if importFile != "" {
+		file, err := os.Open(importFile)
+		if err != nil {
+			fmt.Println("Could not open import file:", err)
+			return
+		}
+		imported, err := ledger.Import(file)
+		file.Close()
+		if err != nil {
+			fmt.Println("Could not import", importFile+":", err)
+			return
+		}
+		fmt.Println("Imported", imported, "rows from", importFile)
+	}
+
+	//id -> [item_name, acronym, rap, value, default_value, demand, trend, projected, hyped, rare]
+	itemDetails := tools.GetLimitedData()
+	if itemDetails == nil {
+		fmt.Println("Could not get item details")
+		return
+	}
+	_, sync, err := reconcileInventory()
+	if err != nil {
+		fmt.Println("Could not fetch inventory, showing the ledger as recorded:", err)
+	} else if sync.Matched > 0 {
+		log.Println("Matched", sync.Matched, "ledger entries to inventory copies")
+	}
+
+	entries := ledger.Entries()
+	marks := make(map[string]portfolioMarks)
+	snapshot := tools.PortfolioSnapshot{Time: time.Now()}
+
+	fmt.Println("____________________________________________________")
+	fmt.Println("Open lots (unrealized P&L at RAP / Value / Forecast)")
+	for _, e := range entries {
+		if !e.Open() {
+			continue
+		}
+		m, ok := marks[e.AssetID]
+		if !ok {
+			m = markItem(e.AssetID, itemDetails.Items[e.AssetID], daysPast, daysFuture)
+			marks[e.AssetID] = m
+		}
+		snapshot.Lots++
+		snapshot.Cost += e.Cost
+		snapshot.AtRAP += m.rap
+		snapshot.AtValue += m.value
+		snapshot.AtForecast += m.forecast
+		if limit > 0 && snapshot.Lots > limit {
+			continue
+		}
+
+		line := fmt.Sprintf("%s (%s) | Cost: %d | P&L: %d / %d / %d | %s %s", m.name, e.AssetID, e.Cost,
+			m.rap-e.Cost, m.value-e.Cost, m.forecast-e.Cost, e.Source, e.Date.Format(time.DateOnly))
+		if e.Serial > 0 {
+			line += fmt.Sprintf(" | #%d", e.Serial)
+		}
+		if e.UAID == 0 {
+			line += " | unmatched"
+		}
+		fmt.Println(line)
+	}
+	if limit > 0 && snapshot.Lots > limit {
+		fmt.Println("...", snapshot.Lots-limit, "more")
+	}
+	fmt.Println("Lots:", snapshot.Lots, "| Cost:", snapshot.Cost,
+		"| At RAP:", snapshot.AtRAP, "("+strconv.Itoa(snapshot.AtRAP-snapshot.Cost)+")",
+		"| At Value:", snapshot.AtValue, "("+strconv.Itoa(snapshot.AtValue-snapshot.Cost)+")",
+		"| At Forecast:", snapshot.AtForecast, "("+strconv.Itoa(snapshot.AtForecast-snapshot.Cost)+")")
+	fmt.Println("Net of the", tools.MarketplaceFee*100, "% fee at RAP:", tools.NetProceeds(snapshot.AtRAP)-snapshot.Cost)
+
+	//Realized P&L, itemized and by month of disposal
+	fmt.Println("____________________________________________________")
+	fmt.Println("Realized")
+	var closed []tools.LedgerEntry
+	for _, e := range entries {
+		if !e.Open() {
+			closed = append(closed, e)
+		}
+	}
+	sort.SliceStable(closed, func(i, j int) bool {
+		return closed[i].Disposal.Date.Before(closed[j].Disposal.Date)
+	})
+	var months []string
+	byMonth := make(map[string]int)
+	for i, e := range closed {
+		snapshot.Realized += e.Realized()
+		month := e.Disposal.Date.Format("2006-01")
+		if _, ok := byMonth[month]; !ok {
+			months = append(months, month)
+		}
+		byMonth[month] += e.Realized()
+		if limit > 0 && i >= len(closed)-limit {
+			name := e.AssetID
+			if details := itemDetails.Items[e.AssetID]; len(details) > 0 {
+				name, _ = details[0].(string)
+			}
+			fmt.Printf("%s (%s) | Cost: %d | %s %d (net %d) on %s | P&L: %d\n", name, e.AssetID, e.Cost,
+				e.Disposal.Kind, e.Disposal.Price, e.Disposal.Proceeds, e.Disposal.Date.Format(time.DateOnly), e.Realized())
+		}
+	}
+	for _, month := range months {
+		fmt.Println(month, "|", byMonth[month])
+	}
+	fmt.Println("Closed:", len(closed), "| Realized P&L:", snapshot.Realized)
+
+	if err == nil {
+		for id, n := range sync.Untracked {
+			log.Println("Held", n, "copies of", id, "with no ledger entry (import them with -import)")
+		}
+		for _, e := range sync.Missing {
+			log.Println("Ledger lot", e.UAID, "of", e.AssetID, "is no longer held (record the sale or trade with -import)")
+		}
+	}
+
+	//Performance over time
+	if err := tools.AppendSnapshot(settings.PortfolioHistoryFile, snapshot); err != nil {
+		log.Println("Could not store portfolio snapshot:", err)
+	}
+	history, err := tools.ReadSnapshots(settings.PortfolioHistoryFile)
+	if err != nil {
+		log.Println("Could not read portfolio history:", err)
+	}
+	if limit > 0 && len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	fmt.Println("____________________________________________________")
+	fmt.Println("History (total P&L at RAP)")
+	for _, s := range history {
+		fmt.Println(s.Time.Format(time.DateTime), "| Lots:", s.Lots, "| Cost:", s.Cost, "| At RAP:", s.AtRAP,
+			"| At Value:", s.AtValue, "| At Forecast:", s.AtForecast, "| Realized:", s.Realized, "| Total:", s.TotalPnL())
+	}
+}
+
+// Marks an item at RAP, value and its average forecast price
+func markItem(id string, details []interface{}, daysPast int64, daysFuture int64) portfolioMarks {
+	m := portfolioMarks{name: id}
+	if len(details) < 4 {
+		return m
+	}
+	m.name, _ = details[0].(string)
+	rap, _ := details[2].(float64)
+	value, _ := details[3].(float64)
+	m.rap, m.value, m.forecast = int(rap), int(value), int(rap)
+	if m.value <= 0 {
+		m.value = m.rap
+	}
+	if forecast, _, _, _, _, _ := modelFourierSTL(id, daysPast, daysFuture, false); !math.IsNaN(forecast) && forecast > 0 {
+		m.forecast = int(math.Round(forecast))
+	}
+	return m
+}
@@ -0,0 +1,538 @@
+package rules
+
+/*
+Small expression language for buy filters, evaluated per deal over named numeric fields.
+Example: demand >= 2 && price < 0.7*max(rap, value) && z < -1
+
+All values are float64; comparisons and logic yield 1 (true) or 0 (false) and any
+non-zero value is true. && and || short-circuit, so costly fields are only looked up
+when reached. Fields with no data should be NaN: reading one fails the whole expression,
+so missing data never passes a rule, not even through != or !.
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Numeric fields an expression may reference, with a short description
+var DealFields = map[string]string{
+	"price":     "Best listing price",
+	"rap":       "Recent average price",
+	"value":     "Rolimons value (-1 if none)",
+	"worth":     "Value if set, else RAP",
+	"deal":      "Discount of price below worth (0.3 = 30% off)",
+	"margin":    "Required margin (watchlist override or demand default)",
+	"demand":    "Demand level (-1 none, 0 terrible .. 4 amazing)",
+	"trend":     "Trend level (-1 none, 0 lowering .. 3 raising)",
+	"projected": "1 if projected, else 0",
+	"hyped":     "1 if hyped, else 0",
+	"rare":      "1 if rare, else 0",
+	"mean":      "Mean of past sales prices",
+	"sd":        "Standard deviation of past sales prices",
+	"z":         "Z-score of price against past sales",
+	"volume30d": "Copies sold in the 30 days up to the latest cached sale",
+	"gap":       "Resale headroom below the next listing if bought (fetches the reseller listings)",
+}
+
+// Functions callable from expressions with their argument count (-1 = one or more)
+var functions = map[string]int{
+	"max": -1,
+	"min": -1,
+	"abs": 1,
+}
+
+// Supplies field values during evaluation
+type Env interface {
+	Field(name string) float64
+}
+
+// Compiled expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Error locating a problem in an expression
+type SyntaxError struct {
+	Src    string
+	Pos    int
+	Reason string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d in %q", e.Reason, e.Pos+1, e.Src)
+}
+
+// Parses src, rejecting fields not in fields and unknown functions
+func Compile(src string, fields map[string]string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{src: src, tokens: tokens, fields: fields}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorAt(tok, "unexpected "+tok.String())
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Evaluates the expression (NaN if a field it reached had no data)
+func (e *Expr) Eval(env Env) float64 {
+	tracked := &missingEnv{Env: env}
+	v := e.root.eval(tracked)
+	if tracked.missing {
+		return math.NaN()
+	}
+	return v
+}
+
+// Evaluates the expression as a condition
+func (e *Expr) Match(env Env) bool {
+	return truthy(e.Eval(env))
+}
+
+// Field names referenced by the expression, sorted
+func (e *Expr) Fields() []string {
+	seen := make(map[string]bool)
+	e.root.fields(seen)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Notes whether any field read during evaluation had no data
+type missingEnv struct {
+	Env
+	missing bool
+}
+
+func (m *missingEnv) Field(name string) float64 {
+	v := m.Env.Field(name)
+	if math.IsNaN(v) {
+		m.missing = true
+	}
+	return v
+}
+
+func truthy(v float64) bool {
+	return v != 0 && !math.IsNaN(v)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// Two-character operators are matched before their one-character prefixes
+var operators = []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "+", "-", "*", "/", "!"}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, &SyntaxError{Src: src, Pos: start, Reason: "bad number " + strconv.Quote(src[start:i])}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], pos: start, num: num})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &SyntaxError{Src: src, Pos: i, Reason: "unexpected character " + strconv.QuoteRune(c)}
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+//Parser (precedence: || < && < ! < comparison < + - < * / < unary -)
+
+type exprParser struct {
+	src    string
+	tokens []token
+	i      int
+	fields map[string]string
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *exprParser) acceptOp(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.i++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) errorAt(tok token, reason string) error {
+	return &SyntaxError{Src: p.src, Pos: tok.pos, Reason: reason}
+}
+
+func (p *exprParser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+}
+
+func (p *exprParser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *exprParser) parseNot() (node, error) {
+	if _, ok := p.acceptOp("!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.acceptOp("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind == tokOp && strings.ContainsAny(tok.text, "<>=") && tok.text != "!" {
+		return nil, p.errorAt(tok, "chained comparison (use &&)")
+	}
+	return binaryNode{op, left, right}, nil
+}
+
+func (p *exprParser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op, left, right}
+	}
+}
+
+func (p *exprParser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op, left, right}
+	}
+}
+
+func (p *exprParser) parseUnary() (node, error) {
+	if _, ok := p.acceptOp("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return constNode(tok.num), nil
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, p.errorAt(closing, "expected \")\" but found "+closing.String())
+		}
+		return inner, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return constNode(1), nil
+		case "false":
+			return constNode(0), nil
+		}
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		if _, ok := p.fields[tok.text]; !ok {
+			return nil, p.errorAt(tok, "unknown field "+tok.String())
+		}
+		return fieldNode(tok.text), nil
+	}
+	return nil, p.errorAt(tok, "unexpected "+tok.String())
+}
+
+func (p *exprParser) parseCall(name token) (node, error) {
+	arity, ok := functions[name.text]
+	if !ok {
+		return nil, p.errorAt(name, "unknown function "+name.String())
+	}
+	p.next() //(
+
+	var args []node
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if closing := p.next(); closing.kind != tokRParen {
+		return nil, p.errorAt(closing, "expected \")\" but found "+closing.String())
+	}
+
+	if (arity == -1 && len(args) == 0) || (arity >= 0 && len(args) != arity) {
+		return nil, p.errorAt(name, fmt.Sprintf("wrong number of arguments to %s (%d)", name.text, len(args)))
+	}
+	return callNode{name.text, args}, nil
+}
+
+//Syntax tree
+
+type node interface {
+	eval(env Env) float64
+	fields(seen map[string]bool)
+}
+
+type constNode float64
+
+func (n constNode) eval(Env) float64       { return float64(n) }
+func (n constNode) fields(map[string]bool) {}
+
+type fieldNode string
+
+func (n fieldNode) eval(env Env) float64        { return env.Field(string(n)) }
+func (n fieldNode) fields(seen map[string]bool) { seen[string(n)] = true }
+
+type negNode struct{ operand node }
+
+func (n negNode) eval(env Env) float64        { return -n.operand.eval(env) }
+func (n negNode) fields(seen map[string]bool) { n.operand.fields(seen) }
+
+type notNode struct{ operand node }
+
+func (n notNode) eval(env Env) float64        { return boolValue(!truthy(n.operand.eval(env))) }
+func (n notNode) fields(seen map[string]bool) { n.operand.fields(seen) }
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(env Env) float64 {
+	return boolValue(truthy(n.left.eval(env)) && truthy(n.right.eval(env)))
+}
+func (n andNode) fields(seen map[string]bool) { n.left.fields(seen); n.right.fields(seen) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(env Env) float64 {
+	return boolValue(truthy(n.left.eval(env)) || truthy(n.right.eval(env)))
+}
+func (n orNode) fields(seen map[string]bool) { n.left.fields(seen); n.right.fields(seen) }
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n binaryNode) eval(env Env) float64 {
+	a, b := n.left.eval(env), n.right.eval(env)
+	switch n.op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	case "<":
+		return boolValue(a < b)
+	case "<=":
+		return boolValue(a <= b)
+	case ">":
+		return boolValue(a > b)
+	case ">=":
+		return boolValue(a >= b)
+	case "==":
+		return boolValue(a == b)
+	case "!=":
+		return boolValue(a != b)
+	}
+	panic("rules: unknown operator " + n.op)
+}
+func (n binaryNode) fields(seen map[string]bool) { n.left.fields(seen); n.right.fields(seen) }
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n callNode) eval(env Env) float64 {
+	result := n.args[0].eval(env)
+	switch n.name {
+	case "abs":
+		return math.Abs(result)
+	case "max":
+		for _, arg := range n.args[1:] {
+			result = math.Max(result, arg.eval(env))
+		}
+	case "min":
+		for _, arg := range n.args[1:] {
+			result = math.Min(result, arg.eval(env))
+		}
+	}
+	return result
+}
+func (n callNode) fields(seen map[string]bool) {
+	for _, arg := range n.args {
+		arg.fields(seen)
+	}
+}
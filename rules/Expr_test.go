@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+var testFields = map[string]string{"price": "", "rap": "", "value": "", "z": "", "demand": ""}
+
+type mapEnv map[string]float64
+
+func (m mapEnv) Field(name string) float64 {
+	if v, ok := m[name]; ok {
+		return v
+	}
+	return math.NaN()
+}
+
+func TestMatch(t *testing.T) {
+	env := mapEnv{"price": 60, "rap": 100, "value": -1, "demand": 2}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"demand >= 2 && price < 0.7*max(rap, value)", true},
+		{"price < 0.5*rap", false},
+		{"price > 100 || rap == 100", true},
+		{"!(price > 100)", true},
+		{"-price + 2*30 == 0", true},
+		{"abs(value) == 1 && min(rap, price, 80) == 60", true},
+		{"true && !false", true},
+
+		//z has no data: every expression reading it fails
+		{"z < -1", false},
+		{"z != 0", false},
+		{"!(z < -1)", false},
+		{"price < 100 && !(z > 3)", false},
+		{"max(z, price) > 0", false},
+
+		//Short-circuiting never reaches z
+		{"price < 100 || z < -1", true},
+		{"price > 100 && z != 0", false},
+	}
+	for _, tt := range tests {
+		expr, err := Compile(tt.src, testFields)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.src, err)
+		}
+		if got := expr.Match(env); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalMissing(t *testing.T) {
+	expr, err := Compile("price - z", testFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := expr.Eval(mapEnv{"price": 5}); !math.IsNaN(v) {
+		t.Errorf("Eval with missing z = %v, want NaN", v)
+	}
+	if v := expr.Eval(mapEnv{"price": 5, "z": 2}); v != 3 {
+		t.Errorf("Eval = %v, want 3", v)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		reason string
+	}{
+		{"volume > 1", "unknown field"},
+		{"avg(price) > 1", "unknown function"},
+		{"abs(price, rap) > 1", "wrong number of arguments"},
+		{"1 < price < 3", "chained comparison"},
+		{"(price > 1", "expected \")\""},
+		{"price > 1 rap", "unexpected"},
+		{"price # 1", "unexpected character"},
+		{"1..2 > price", "bad number"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src, testFields)
+		if err == nil || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("Compile(%q) error = %v, want %q", tt.src, err, tt.reason)
+		}
+	}
+}
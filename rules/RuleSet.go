@@ -0,0 +1,90 @@
+package rules
+
+/*
+Ordered list of named buy filter rules. The first rule whose condition holds decides
+the deal (buy or skip); when none match the deal is skipped.
+*/
+
+import (
+	"errors"
+	"fmt"
+)
+
+// What happens to a deal when a rule fires
+type Action string
+
+const (
+	ActionBuy  Action = "buy"
+	ActionSkip Action = "skip"
+)
+
+// Rule as written in settings
+type Rule struct {
+	Name   string `yaml:"name"`
+	When   string `yaml:"when"`   //Condition expression
+	Action Action `yaml:"action"` //buy or skip
+}
+
+// Compiled rules in evaluation order
+type RuleSet struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	expr *Expr
+}
+
+// Compiles every rule, reporting all invalid ones
+func CompileRules(list []Rule, fields map[string]string) (*RuleSet, error) {
+	var errs []error
+	rs := &RuleSet{}
+	names := make(map[string]bool)
+	for i, rule := range list {
+		label := fmt.Sprintf("rule %d", i+1)
+		if rule.Name != "" {
+			label = fmt.Sprintf("rule %q", rule.Name)
+		}
+		if rule.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name not set", label))
+		} else if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("%s: name used twice", label))
+		}
+		names[rule.Name] = true
+
+		if rule.Action != ActionBuy && rule.Action != ActionSkip {
+			errs = append(errs, fmt.Errorf("%s: action %q must be %q or %q", label, rule.Action, ActionBuy, ActionSkip))
+		}
+		expr, err := Compile(rule.When, fields)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", label, err))
+			continue
+		}
+		rs.rules = append(rs.rules, compiledRule{Rule: rule, expr: expr})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// First rule whose condition holds, in order
+func (rs *RuleSet) First(env Env) (Rule, bool) {
+	if rs == nil {
+		return Rule{}, false
+	}
+	for _, r := range rs.rules {
+		if r.expr.Match(env) {
+			return r.Rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Number of rules
+func (rs *RuleSet) Len() int {
+	if rs == nil {
+		return 0
+	}
+	return len(rs.rules)
+}
@@ -0,0 +1,66 @@
+package secret
+
+/*
+Keeps credentials out of logs: a Secret prints, formats and marshals as a redaction
+marker, and only Reveal returns the raw value for request headers. Lives in its own
+package so config and the packages config depends on (notify) can share it.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Credential whose text, JSON and YAML forms are redacted
+type Secret struct {
+	value string
+}
+
+// Wraps a raw credential
+func New(value string) Secret {
+	return Secret{value: value}
+}
+
+// Raw credential, only for building request headers
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+// Checks whether a credential was provided
+func (s Secret) IsSet() bool {
+	return s.value != ""
+}
+
+func (s Secret) String() string {
+	if !s.IsSet() {
+		return "[unset]"
+	}
+	return "[REDACTED]"
+}
+
+func (s Secret) GoString() string {
+	return "secret.Secret(" + s.String() + ")"
+}
+
+func (s Secret) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		io.WriteString(f, s.GoString())
+		return
+	}
+	io.WriteString(f, s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+// Reads the raw credential from a settings file value
+func (s *Secret) UnmarshalText(text []byte) error {
+	s.value = string(text)
+	return nil
+}
@@ -0,0 +1,60 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSecretRedacted(t *testing.T) {
+	const raw = "hunter2"
+	type holder struct {
+		Cookie Secret `json:"cookie" yaml:"cookie"`
+	}
+	s := New(raw)
+	forms := map[string]func() (string, error){
+		"%s":   func() (string, error) { return fmt.Sprintf("%s", s), nil },
+		"%v":   func() (string, error) { return fmt.Sprintf("%v", s), nil },
+		"%+v":  func() (string, error) { return fmt.Sprintf("%+v", holder{s}), nil },
+		"%#v":  func() (string, error) { return fmt.Sprintf("%#v", s), nil },
+		"%q":   func() (string, error) { return fmt.Sprintf("%q", s), nil },
+		"json": func() (string, error) { b, err := json.Marshal(holder{s}); return string(b), err },
+		"yaml": func() (string, error) { b, err := yaml.Marshal(holder{s}); return string(b), err },
+	}
+	for name, form := range forms {
+		t.Run(name, func(t *testing.T) {
+			out, err := form()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(out, raw) || !strings.Contains(out, "[REDACTED]") {
+				t.Errorf("%s = %q, want it redacted", name, out)
+			}
+		})
+	}
+
+	if got := fmt.Sprintf("%#v", s); got != "secret.Secret([REDACTED])" {
+		t.Errorf("%%#v = %q", got)
+	}
+	if got := fmt.Sprint(Secret{}); got != "[unset]" {
+		t.Errorf("unset = %q", got)
+	}
+	if s.Reveal() != raw {
+		t.Errorf("Reveal = %q, want %q", s.Reveal(), raw)
+	}
+}
+
+func TestSecretUnmarshal(t *testing.T) {
+	var settings struct {
+		Cookie Secret `yaml:"cookie"`
+	}
+	if err := yaml.Unmarshal([]byte("cookie: hunter2\n"), &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Cookie.Reveal() != "hunter2" {
+		t.Errorf("Reveal = %q", settings.Cookie.Reveal())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"robolimited/tools"
+	"time"
+)
+
+/*
+Shadow execution of paper buys (shadow_fills): after a simulated decision the live
+reseller listings are checked, and the buy is only booked if a listing at or below
+the deal price was still up, at that listing's price and serial. Without shadow_fills
+the same lookup only supplies the serial of the listing a live buy would have picked.
+*/
+
+// Recorder of the running monitor (nil unless shadow_fills is on)
+var shadows *tools.ShadowRecorder
+
+// Last shadow check, reused by the other strategies buying the same deal
+type shadowCache struct {
+	event    DealEvent
+	fill     tools.ShadowFill
+	listings []tools.ResellerResponse
+	set      bool
+}
+
+// Fetches the live listings of a paper buy's deal once (executor only)
+func (p *pipeline) lookupListings(order buyOrder) shadowCache {
+	event := order.event
+	if !p.lastShadow.set || p.lastShadow.event != event {
+		fill := tools.ShadowFill{AssetID: event.ID, Price: event.Price}
+		var listings []tools.ResellerResponse
+		collectibleItemId, err := tools.GetCollectibleId(event.ID)
+		if err == nil {
+			listings, err = tools.GetResellers(collectibleItemId)
+			fill.Match(listings)
+			serialModel.Observe(listings)
+		}
+		if err != nil {
+			fill.Error = err.Error()
+		}
+		fill.Time = time.Now()
+		fill.CheckLatency = fill.Time.Sub(time.Unix(event.Timestamp, 0)).Seconds()
+		p.lastShadow = shadowCache{event: event, fill: fill, listings: listings, set: true}
+	}
+	return p.lastShadow
+}
+
+// Serial of the listing a live buy would have picked for a paper buy (0 if none was up)
+func (p *pipeline) paperSerial(order buyOrder) int64 {
+	lookup := p.lookupListings(order)
+	if order.trace != nil {
+		order.trace.Mark("listings")
+	}
+	if len(lookup.listings) == 0 {
+		return 0
+	}
+	book := tools.BuildOrderBook(lookup.listings)
+	listing, _ := serialModel.SelectListing(book, p.settings.SerialSearchDepth, order.event.Price)
+	return listing.SerialNumber
+}
+
+// Checks a paper buy against the live listings (executor only)
+func (p *pipeline) shadowFill(order buyOrder) tools.ShadowFill {
+	fill := p.lookupListings(order).fill
+	if order.trace != nil {
+		order.trace.Mark("shadow")
+	}
+
+	fill.Strategy = p.runners[order.runner].strategy.Name()
+	shadows.Record(fill)
+	shadowFills.Inc(fill.Strategy, fill.Result())
+	if p.settings.LogConsole || fill.Error != "" {
+		log.Println("Shadow", fill.Strategy, "| Item:", order.market.Name, "| Deal:", fill.Price, "| Best:", fill.BestPrice, "|", fill.Result(), "|", fill.Error)
+	}
+	return fill
+}
+
+// Logs fill rates of paper buys so far
+func logShadowFills() {
+	for _, stats := range shadows.Stats() {
+		log.Println(stats)
+	}
+}
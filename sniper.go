@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
 	"robolimited/config"
+	"robolimited/notify"
 	"robolimited/tools"
 	"strings"
 	"net/http"
@@ -12,12 +14,15 @@ import (
 	"bytes"
 	"io"
     "os"
+    "time"
     "github.com/google/uuid"
 )
 
 
-var CSRFToken string = ""
-var consoleLog *os.File
+var tokens *tools.TokenManager
+var purchaseLog = log.New(os.Stderr, "", log.LstdFlags) //Purchase path, written to console_log_file once the sniper starts
+var serialModel *tools.SerialModel
+var purchases *tools.PurchaseRegistry
 
 type PurchasePayload struct {
     CollectibleItemId         string  `json:"collectibleItemId"`
@@ -32,154 +37,340 @@ type PurchasePayload struct {
     IdempotencyKey            string  `json:"idempotencyKey"`
 }
 
-//Retrieves CSRF token for later use
-func getCSRFToken(collectibleItemId string, cookie string, payload PurchasePayload) error {
-    url := fmt.Sprintf(config.PurchaseAPI, collectibleItemId)
-    client := tools.GlobalClient
+//Item whose purchase endpoint is probed for a fresh X-CSRF token
+const csrfProbeItem = "21070012"
 
-    bodyData, err := json.Marshal(payload)
-    if err != nil {
-        return err
+var probeCollectibleId string //Only touched inside the token manager's single refresh
+
+//Fetches a new X-CSRF token from the 403 of an unauthenticated purchase request
+func fetchCSRFToken() (string, error) {
+    if probeCollectibleId == "" {
+        id, err := tools.GetCollectibleId(csrfProbeItem)
+        if err != nil {
+            return "", err
+        }
+        probeCollectibleId = id
     }
+    url := fmt.Sprintf(config.PurchaseAPI, probeCollectibleId)
+    client := tools.GlobalClient
 
-    req, err := http.NewRequest("POST", url, bytes.NewBuffer(bodyData))
+    req, err := http.NewRequest("POST", url, bytes.NewBufferString("{}"))
     if err != nil {
-        return err
+        return "", err
     }
 
     tools.FastHeaders(req)
     req.Header.Set("Content-Type", "application/json; charset=utf-8")
-    req.Header.Set("Cookie", fmt.Sprintf(".ROBLOSECURITY=%s", cookie))
-    
+    tools.SetSessionCookie(req)
 
     resp, err := client.Do(req)
     if err != nil {
-        return err
+        tools.CountAPIError("csrf", 0)
+        return "", err
     }
     defer resp.Body.Close()
+    if resp.StatusCode != 403 {
+        tools.CountAPIError("csrf", resp.StatusCode)
+    }
+
+    if resp.StatusCode == http.StatusUnauthorized {
+        return "", tools.ErrSessionExpired
+    }
 
     //Handle CSRF token protection
-    if resp.StatusCode == 403 {
-        CSRFToken = resp.Header.Get("x-csrf-token")
-        if CSRFToken == "" {
-            return errors.New("no CSRF token found in 403 response")
+    token := resp.Header.Get("x-csrf-token")
+    if resp.StatusCode != 403 || token == "" {
+        return "", fmt.Errorf("no X-CSRF token in response (status %d)", resp.StatusCode)
+    }
+    return token, nil
+}
+
+//Refreshes the X-CSRF token, telling an expired session apart from other failures
+func refreshCSRFToken(stale string) (string, error) {
+    age := tokens.Age()
+    token, err := tokens.Refresh(stale)
+    if err == nil {
+        purchaseLog.Println("Refreshed X-CSRF token, previous one was", age.Round(time.Second), "old")
+    } else {
+        if _, sessionErr := tools.ValidateSession(); sessionErr != nil {
+            err = sessionErr
         }
+        purchaseLog.Println("Could not refresh X-CSRF token:", err)
     }
-    
-    return nil
+    return token, err
 }
 
-//Purchases item by making request to API endpoint
-func purchaseItem(collectibleItemId string, cookie string, payload PurchasePayload, retry bool) error {
-    //Write status to log file
-    log.SetOutput(consoleLog)
-    defer log.SetOutput(os.Stderr)
+//Purchase API response body
+type purchaseResponse struct {
+    Purchased      bool    `json:"purchased"`
+    Pending        bool    `json:"pending"`
+    PurchaseResult string  `json:"purchaseResult"`
+    ErrorMessage   *string `json:"errorMessage"`
+}
 
-    url := fmt.Sprintf(config.PurchaseAPI, collectibleItemId)
-    client := tools.GlobalClient
+//Request may or may not have reached the API (outcome unknown)
+var errNoResponse = errors.New("no response to purchase request")
 
+//Purchases item by making request to API endpoint, refreshing a rejected X-CSRF token once
+func purchaseItem(collectibleItemId string, payload PurchasePayload) (purchaseResponse, error) {
+    var result purchaseResponse
     bodyData, err := json.Marshal(payload)
     if err != nil {
-        return err
+        return result, err
+    }
+
+    token, err := tokens.EnsureFresh(time.Duration(settings.CSRFMaxAge) * time.Second)
+    if err != nil {
+        return result, err
     }
 
-    //Make POST request with current token
+    status, respBody, err := postPurchase(collectibleItemId, bodyData, token)
+    if err != nil {
+        return result, err
+    }
+
+    //Generate new X-CSRF token if invalid
+    if status == 403 {
+        if token, err = refreshCSRFToken(token); err != nil {
+            return result, err
+        }
+        status, respBody, err = postPurchase(collectibleItemId, bodyData, token)
+        if err != nil {
+            return result, err
+        }
+        if status == 403 {
+            return result, errors.New("purchase rejected with 403 after refreshing X-CSRF token")
+        }
+    }
+
+    if status == http.StatusUnauthorized {
+        purchaseLog.Println(tools.ErrSessionExpired)
+        return result, tools.ErrSessionExpired
+    }
+
+    if status != 200 && status != 201 {
+		purchaseLog.Printf("Purchase failed: status %d, response %s \n", status, string(respBody))
+        return result, fmt.Errorf("purchase failed with status %d", status)
+    }
+
+    if strings.Contains(string(respBody), "errors") {
+		purchaseLog.Printf("Purchase API error: %s \n", string(respBody))
+        return result, errors.New("purchase API error: " + string(respBody))
+    }
+
+    if err := json.Unmarshal(respBody, &result); err != nil {
+        purchaseLog.Println("Could not read purchase response:", string(respBody))
+    }
+    purchaseLog.Println("Purchase request executed:", string(respBody))
+    return result, nil
+}
+
+//Sends one purchase request with the given X-CSRF token, returns status and body
+func postPurchase(collectibleItemId string, bodyData []byte, token string) (int, []byte, error) {
+    url := fmt.Sprintf(config.PurchaseAPI, collectibleItemId)
+    client := tools.GlobalClient
+
     req, err := http.NewRequest("POST", url, bytes.NewBuffer(bodyData))
     if err != nil {
-        return err
+        return 0, nil, err
     }
 
     tools.FastHeaders(req)
     req.Header.Set("Content-Type", "application/json; charset=utf-8")
-    req.Header.Set("Cookie", fmt.Sprintf(".ROBLOSECURITY=%s", cookie))
-    req.Header.Set("X-CSRF-TOKEN", CSRFToken)
+    tools.SetSessionCookie(req)
+    req.Header.Set("X-CSRF-TOKEN", token)
 
     resp, err := client.Do(req)
     if err != nil {
-        return err
+        tools.CountAPIError("purchase", 0)
+        return 0, nil, fmt.Errorf("%w: %v", errNoResponse, err)
     }
     defer resp.Body.Close()
 
     respBody, err := io.ReadAll(resp.Body)
     if err != nil {
-        return err
-    }
-
-    //Generate new X-CSRF token if invalid
-    if resp.StatusCode == 403 {
-        getCSRFToken(collectibleItemId, cookie, payload)
-        if !retry {
-            log.Println("Could not get X-CSRF token.")
-            return err
-        }
-        return purchaseItem(collectibleItemId, cookie, payload, false)
+        tools.CountAPIError("purchase", 0)
+        return resp.StatusCode, nil, fmt.Errorf("%w: %v", errNoResponse, err)
     }
-
     if resp.StatusCode != 200 && resp.StatusCode != 201 {
-		log.Printf("Purchase failed: status %d, response %s \n", resp.StatusCode, string(respBody))
-        return err
+        tools.CountAPIError("purchase", resp.StatusCode)
     }
+    return resp.StatusCode, respBody, nil
+}
 
-    if strings.Contains(string(respBody), "errors") {
-		log.Printf("Purchase API error: %s \n", string(respBody))
-        return err
+//A strategy's buy decision on a deal, carried to the purchase
+type purchaseVerdict struct {
+    Decision
+    maxPrice int       //Most a listing may cost: the approved deal price, capped by the item's max_price
+    seen     time.Time //Activity time of the deal
+}
+
+//Executes purchase on an item via API call to economy endpoint, returns the listing bought
+//The strategy has already judged the deal; only its freshness and the listing's price are checked here
+//Steps are marked on timer (the deal's latency trace), or on a new timer if nil
+func ExecutePurchase(id string, verdict purchaseVerdict, timer *tools.StepTimer) (tools.ResellerResponse, bool) {
+    //Time each step of the purchase path
+    if timer == nil {
+        timer = tools.NewStepTimer()
     }
+    defer func() {
+        purchaseLog.Println("Purchase timings |", id, "|", timer)
+    }()
 
-    log.Println("Purchase request executed:", string(respBody))
-    return nil
-}
+    //Fills are confirmed against the copies held when ordering
+    if heldCopies(id) < 0 {
+        purchaseLog.Println("No inventory snapshot yet, skipped", id)
+        return tools.ResellerResponse{}, false
+    }
+    if age := time.Since(verdict.seen); age > time.Duration(settings.MaxDealAge)*time.Second {
+        purchaseLog.Println("Deal on", id, "is", age.Round(time.Second), "old, skipped")
+        return tools.ResellerResponse{}, false
+    }
 
-//Executes purchase on an item via API call to economy endpoint
-func ExecutePurchase(id string, bypass bool, value float64, isDemand bool) bool {
-    cookie := config.RobloxCookie
-    collectibleItemId, _ := tools.GetCollectibleId(id)
+    collectibleItemId, err := tools.GetCollectibleId(id)
+    timer.Mark("resolve")
+    if err != nil {
+        purchaseLog.Println("Could not resolve collectible id:", err)
+        return tools.ResellerResponse{}, false
+    }
 	sellers, err := tools.GetResellers(collectibleItemId)
-
-    //Write status to log file
-    log.SetOutput(consoleLog)
-    defer log.SetOutput(os.Stderr)
-    
+	timer.Mark("resellers")
 	if err != nil {
-		log.Println("Could not get reseller data:", err)
-		return false
+		purchaseLog.Println("Could not get reseller data:", err)
+		return tools.ResellerResponse{}, false
 	}
     if len(sellers) == 0 {
-        log.Println("No available sellers found.")
-        return false
+        purchaseLog.Println("No available sellers found.")
+        return tools.ResellerResponse{}, false
     }
     
-	topSeller := sellers[0]
-
-	//Validate actual price with expected
-	if bypass || CheckDip(id, float64(topSeller.Price), value, isDemand) {
-		//Request purchase using HTTP POST with payload
-		payload := PurchasePayload{
-            CollectibleItemId: collectibleItemId,
-            CollectibleItemInstanceId: topSeller.CollectibleItemInstanceID,
-            CollectibleProductId: topSeller.CollectibleProductID,
-			ExpectedCurrency: 1,
-			ExpectedPrice:    int64(topSeller.Price),
-            ExpectedPurchaserId: config.RobloxId,
-            ExpectedPurchaserType: "User",
-            ExpectedSellerId: topSeller.Seller.SellerId,
-			ExpectedSellerType: "User",
-            IdempotencyKey: uuid.New().String(),
-		}
-		err := purchaseItem(collectibleItemId, cookie, payload, true)
-		if err != nil {
-			log.Println("Error making purchase:", err)
-			return false
+	book := tools.BuildOrderBook(sellers)
+
+	//Pay no more than the price the strategy approved; serial premiums only rank the listings within it
+	serialModel.Observe(sellers) //Refit in the background
+	topSeller, ok := serialModel.SelectListing(book, settings.SerialSearchDepth, verdict.maxPrice)
+	timer.Mark("select")
+	if !ok {
+		purchaseLog.Println("Best price of", book.BestPrice, "is above the approved", verdict.maxPrice)
+		return tools.ResellerResponse{}, false
+	}
+	purchaseLog.Println("Buying", id, "for", topSeller.Price, "|", verdict.Reason)
+
+	//Request purchase using HTTP POST with payload
+	payload := PurchasePayload{
+        CollectibleItemId: collectibleItemId,
+        CollectibleItemInstanceId: topSeller.CollectibleItemInstanceID,
+        CollectibleProductId: topSeller.CollectibleProductID,
+		ExpectedCurrency: 1,
+		ExpectedPrice:    int64(topSeller.Price),
+        ExpectedPurchaserId: settings.RobloxId,
+        ExpectedPurchaserType: "User",
+        ExpectedSellerId: topSeller.Seller.SellerId,
+		ExpectedSellerType: "User",
+        IdempotencyKey: uuid.New().String(),
+	}
+	//Refuse listings already bought or being bought, and recent rebuys
+	instanceId := topSeller.CollectibleItemInstanceID
+	if err := purchases.Reserve(tools.LiveScope, id, instanceId, time.Now()); err != nil {
+		purchaseLog.Println("Skipped purchase |", err)
+		return tools.ResellerResponse{}, false
+	}
+	order := openOrder(id, collectibleItemId, topSeller, payload.IdempotencyKey)
+	result, err := purchaseItem(collectibleItemId, payload)
+	timer.Mark("post")
+	recordOutcome(order, result, err)
+	notifyOutcome(id, topSeller, result, err)
+	timer.Mark("result")
+	if err != nil {
+		purchaseLog.Println("Error making purchase:", err)
+		if errors.Is(err, errNoResponse) {
+			//May have gone through; keep the listing blocked
+			purchases.Commit(tools.LiveScope, id, instanceId, time.Now())
+		} else {
+			purchases.Release(tools.LiveScope, id, instanceId)
 		}
-		return true
-	} else {
-        log.Println("Price of", topSeller.Price, "does not match.")
+		return tools.ResellerResponse{}, false
+	}
+	if !result.Purchased && !result.Pending {
+		purchaseLog.Println("Not purchased |", result.PurchaseResult)
+		purchases.Release(tools.LiveScope, id, instanceId)
+		return tools.ResellerResponse{}, false
+	}
+	purchases.Commit(tools.LiveScope, id, instanceId, time.Now())
+	return topSeller, true
+}
+
+//Notifies the outcome of a live purchase
+func notifyOutcome(id string, listing tools.ResellerResponse, result purchaseResponse, err error) {
+    switch {
+    case errors.Is(err, tools.ErrSessionExpired):
+        notifier.Notify(notify.SessionExpired(err))
+    case err != nil:
+        notifier.Notify(notify.PurchaseFailed(id, listing.Price, err.Error()))
+    case result.Purchased || result.Pending:
+        notifier.Notify(notify.Purchase(id, listing.Price, listing.SerialNumber))
+    default:
+        reason := result.PurchaseResult
+        if result.ErrorMessage != nil {
+            reason = *result.ErrorMessage
+        }
+        notifier.Notify(notify.PurchaseFailed(id, listing.Price, "not purchased: "+reason))
     }
+}
 
-	return false
+//Time between background refits of the serial model
+const serialRefitInterval = time.Minute
+
+//Refits and stores serial premiums off the purchase path until ctx is cancelled
+func runSerialModel(ctx context.Context) {
+    ticker := time.NewTicker(serialRefitInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            serialModel.Refit(settings.SerialModelFile)
+        }
+    }
 }
 
-//Initialize tokens
-func init() {
-    //Set log to file
-    consoleLog, _ = os.OpenFile(config.ConsoleLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+//Initialize purchase logging and serial model, fails if the purchase registry or order history cannot be kept
+func initSniper() error {
+    //Log purchases to file, leaving the process-wide logger alone
+    consoleLog, err := os.OpenFile(settings.ConsoleLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        log.Println("Could not open console log, purchases log to stderr:", err)
+    } else {
+        purchaseLog = log.New(consoleLog, "", log.LstdFlags)
+    }
+
+    //X-CSRF token shared by all purchases
+    tokens = tools.NewTokenManager(fetchCSRFToken)
+
+    //Load fitted serial premiums
+    serialModel = tools.LoadSerialModel(settings.SerialModelFile)
+
+    //Load recent purchases to guard against duplicates; refuse to start without them
+    purchases, err = tools.LoadPurchaseRegistry(settings.PurchaseRegistryFile, time.Duration(settings.RebuyCooldown)*time.Second)
+    if err != nil {
+        return fmt.Errorf("could not load purchase registry (fix or move it aside to start without duplicate history): %w", err)
+    }
+
+    //Load order history
+    orders, err = tools.LoadOrderStore(settings.OrdersFile)
+    if errors.Is(err, tools.ErrCorruptFile) {
+        //Keep the unreadable history for inspection, start a new one in its place
+        moved, moveErr := tools.MoveAside(settings.OrdersFile, time.Now())
+        if moveErr != nil {
+            return fmt.Errorf("could not load orders: %v (moving it aside: %v)", err, moveErr)
+        }
+        log.Println("WARNING: could not load orders, moved", settings.OrdersFile, "to", moved, "and started a new history:", err)
+        orders, err = tools.LoadOrderStore(settings.OrdersFile)
+    }
+    if err != nil {
+        return fmt.Errorf("could not load orders: %w", err)
+    }
+
+    return nil
 }
\ No newline at end of file
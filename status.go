@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"robolimited/config"
+	"robolimited/notify"
+	"robolimited/tools"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Status page and JSON API of a running monitor (status_addr or -status): settings,
+recent decisions, simulated positions, orders and API health. Pause, resume and the
+kill switch require the token from status_token_file.
+*/
+
+//go:embed web/status.html
+var statusPage []byte
+
+// Decisions kept for the status page
+const decisionHistory = 500
+
+// One strategy decision on a deal
+type decisionRecord struct {
+	Time       time.Time `json:"time"`
+	Strategy   string    `json:"strategy"`
+	ItemID     string    `json:"item_id"`
+	Name       string    `json:"name"`
+	Price      int       `json:"price"`
+	Buy        bool      `json:"buy"`
+	Confidence float64   `json:"confidence"`
+	Reason     string    `json:"reason"`
+}
+
+// Ring buffer of the latest decisions
+type decisionLog struct {
+	mu      sync.Mutex
+	records []decisionRecord
+	next    int
+}
+
+var recentDecisions = &decisionLog{}
+
+func (l *decisionLog) add(strategy string, event DealEvent, market *MarketContext, decision Decision) {
+	record := decisionRecord{
+		Time:       time.Now(),
+		Strategy:   strategy,
+		ItemID:     event.ID,
+		Name:       market.Name,
+		Price:      event.Price,
+		Buy:        decision.Buy,
+		Confidence: decision.Confidence,
+		Reason:     decision.Reason,
+	}
+	if math.IsNaN(record.Confidence) || math.IsInf(record.Confidence, 0) {
+		record.Confidence = 0 //Not representable in JSON
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) < decisionHistory {
+		l.records = append(l.records, record)
+		return
+	}
+	l.records[l.next] = record
+	l.next = (l.next + 1) % decisionHistory
+}
+
+// Latest n decisions, newest first
+func (l *decisionLog) latest(n int) []decisionRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n = min(n, len(l.records))
+	latest := make([]decisionRecord, 0, n)
+	for k := 1; k <= n; k++ {
+		i := (l.next - k + len(l.records)) % len(l.records)
+		latest = append(latest, l.records[i])
+	}
+	return latest
+}
+
+// One held simulated lot
+type position struct {
+	Strategy string `json:"strategy"`
+	ItemID   string `json:"item_id"`
+	Name     string `json:"name"`
+	Price    int    `json:"price"`
+	Serial   int64  `json:"serial,omitempty"`
+	Worth    int    `json:"worth"` //Current max(RAP, value)
+}
+
+// Open simulated lots of every strategy
+func (p *pipeline) positions() []position {
+	itemDetails := p.itemDetails.Load()
+	p.simMu.Lock()
+	defer p.simMu.Unlock()
+	var positions []position
+	for _, r := range p.runners {
+		for id, lots := range r.sim.Portfolio {
+			name := id
+			if itemDetails != nil && len(itemDetails.Items[id]) > 0 {
+				name, _ = itemDetails.Items[id][0].(string)
+			}
+			for _, lot := range lots {
+				positions = append(positions, position{
+					Strategy: r.strategy.Name(),
+					ItemID:   id,
+					Name:     name,
+					Price:    lot.Price,
+					Serial:   lot.Serial,
+					Worth:    lotWorth(itemDetails, id, lot),
+				})
+			}
+		}
+	}
+	return positions
+}
+
+// Seconds since a unix-nanosecond timestamp (-1 if never set)
+func secondsSince(unixNano int64) float64 {
+	if unixNano == 0 {
+		return -1
+	}
+	return time.Since(time.Unix(0, unixNano)).Seconds()
+}
+
+// Loads the action token, generating and saving one if none exists
+func statusToken() (config.Secret, error) {
+	token, err := config.LoadSecret(config.StatusTokenEnv, settings.StatusTokenFile)
+	if err != nil || token.IsSet() {
+		return token, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return token, err
+	}
+	value := hex.EncodeToString(raw)
+	if err := os.WriteFile(settings.StatusTokenFile, []byte(value+"\n"), 0600); err != nil {
+		return token, err
+	}
+	log.Println("Generated status token in", settings.StatusTokenFile)
+	return config.NewSecret(value), nil
+}
+
+type statusServer struct {
+	p     *pipeline
+	kill  context.CancelFunc
+	token config.Secret
+}
+
+// Serves the status page and API on addr until ctx is cancelled; kill stops the monitor
+func serveStatus(ctx context.Context, addr string, p *pipeline, kill context.CancelFunc) {
+	token, err := statusToken()
+	if err != nil {
+		log.Println("Status page disabled, no action token:", err)
+		return
+	}
+	s := &statusServer{p: p, kill: kill, token: token}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(statusPage)
+	})
+	mux.HandleFunc("GET /api/config", s.config)
+	mux.HandleFunc("GET /api/decisions", s.decisions)
+	mux.HandleFunc("GET /api/positions", s.positions)
+	mux.HandleFunc("GET /api/orders", s.orders)
+	mux.HandleFunc("GET /api/health", s.health)
+	mux.HandleFunc("POST /api/pause", s.authorized(s.pause))
+	mux.HandleFunc("POST /api/resume", s.authorized(s.resume))
+	mux.HandleFunc("POST /api/kill", s.authorized(s.killSwitch))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Println("Serving status page on http://" + addr + "/")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println("Status page stopped:", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error writing status response:", err)
+	}
+}
+
+// Limit from the n query parameter
+func queryLimit(r *http.Request, fallback int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
+
+func (s *statusServer) config(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, publicSettings())
+}
+
+// Settings safe to serve without a token: secrets (cookie, webhook URLs) marshal redacted, SMTP logins are blanked
+func publicSettings() config.Settings {
+	public := *settings
+	public.Notifications = make([]notify.SinkConfig, len(settings.Notifications))
+	for i, sink := range settings.Notifications {
+		if sink.Username != "" {
+			sink.Username = "[REDACTED]"
+		}
+		public.Notifications[i] = sink
+	}
+	return public
+}
+
+func (s *statusServer) decisions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, recentDecisions.latest(queryLimit(r, 50)))
+}
+
+func (s *statusServer) positions(w http.ResponseWriter, r *http.Request) {
+	positions := s.p.positions()
+	if positions == nil {
+		positions = []position{}
+	}
+	writeJSON(w, positions)
+}
+
+func (s *statusServer) orders(w http.ResponseWriter, r *http.Request) {
+	all := orders.All()
+	if n := queryLimit(r, 50); len(all) > n {
+		all = all[len(all)-n:]
+	}
+	writeJSON(w, all)
+}
+
+func (s *statusServer) health(w http.ResponseWriter, r *http.Request) {
+	errs := tools.APIErrors()
+	if errs == nil {
+		errs = []tools.Sample{}
+	}
+	writeJSON(w, map[string]any{
+		"live_money":               s.p.liveMoney,
+		"paused":                   s.p.paused.Load(),
+		"halted":                   s.p.halted.Load(),
+		"last_poll_seconds":        secondsSince(s.p.lastPoll.Load()),
+		"item_details_age_seconds": secondsSince(s.p.refreshed.Load()),
+		"csrf_token_age_seconds":   tokens.Age().Seconds(),
+		"orders":                   orders.Summary(),
+		"activities":               s.p.tracker.Totals().String(),
+		"api_errors":               errs,
+	})
+}
+
+// Rejects requests without the action token
+func (s *statusServer) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(s.token.Reveal())) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *statusServer) pause(w http.ResponseWriter, r *http.Request) {
+	s.p.paused.Store(true)
+	log.Println("Monitor paused from status page")
+	notifier.Notify(notify.Monitor(notify.Warning, "paused", "from status page"))
+	s.health(w, r)
+}
+
+func (s *statusServer) resume(w http.ResponseWriter, r *http.Request) {
+	s.p.paused.Store(false)
+	log.Println("Monitor resumed from status page")
+	notifier.Notify(notify.Monitor(notify.Info, "resumed", "from status page"))
+	s.health(w, r)
+}
+
+// Drops queued orders and stops the monitor
+func (s *statusServer) killSwitch(w http.ResponseWriter, r *http.Request) {
+	s.p.halted.Store(true)
+	log.Println("Kill switch triggered from status page")
+	notifier.Notify(notify.Monitor(notify.Critical, "killed", "kill switch triggered from status page"))
+	s.kill()
+	s.health(w, r)
+}
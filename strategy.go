@@ -0,0 +1,361 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"robolimited/rules"
+	"robolimited/tools"
+	"sort"
+	"strings"
+)
+
+/*
+Pluggable buy strategies. Each strategy sees the same deal event and market context
+and returns a decision with a reason and confidence, so several strategies can be
+compared side by side on one live feed, each with its own simulated ledger.
+*/
+
+// Best price update seen on the deals feed
+type DealEvent struct {
+	Timestamp int64
+	ID        string
+	Price     int
+}
+
+// Market data about the item of a deal
+type MarketContext struct {
+	ID       string
+	Name     string
+	Acronym  string
+	RAP      int
+	Value    int //-1 if item has no value
+	IsDemand bool
+	Details  ItemLevels
+	Margin   float64        //Margin below RAP/Value to buy (watchlist override or demand default)
+	Rule     tools.ItemRule //Watchlist overrides of the item
+
+	book    *tools.OrderBook
+	bookErr error
+	fetched bool
+}
+
+// Rolimons item levels (-1 when unset)
+type ItemLevels struct {
+	Demand    int
+	Trend     int
+	Projected int
+	Hyped     int
+	Rare      int
+}
+
+// Reads item levels from a Rolimons item details row
+func itemLevels(details []any) ItemLevels {
+	level := func(k int) int {
+		if k < len(details) {
+			if f, ok := details[k].(float64); ok {
+				return int(f)
+			}
+		}
+		return -1
+	}
+	return ItemLevels{Demand: level(5), Trend: level(6), Projected: level(7), Hyped: level(8), Rare: level(9)}
+}
+
+// Reseller order book of the item, fetched on first use
+func (m *MarketContext) OrderBook() (*tools.OrderBook, error) {
+	if !m.fetched {
+		m.fetched = true
+		collectibleItemId, err := tools.GetCollectibleId(m.ID)
+		if err != nil {
+			m.bookErr = err
+			return nil, err
+		}
+		sellers, err := tools.GetResellers(collectibleItemId)
+		if err != nil {
+			m.bookErr = err
+			return nil, err
+		}
+		m.book = tools.BuildOrderBook(sellers)
+	}
+	return m.book, m.bookErr
+}
+
+// Resale headroom of the listing a buy at price would take (see OrderBook.ResaleGap)
+func (m *MarketContext) ResaleGap(price int) (float64, error) {
+	book, err := m.OrderBook()
+	if err != nil {
+		return math.NaN(), err
+	}
+	listing, ok := serialModel.SelectListing(book, settings.SerialSearchDepth, price)
+	if !ok {
+		return math.NaN(), fmt.Errorf("no listing at or below %d", price)
+	}
+	return book.ResaleGap(listing), nil
+}
+
+// Worth used for margins (Value if the item has one, else RAP)
+func (m *MarketContext) Worth() int {
+	if m.Value != -1 {
+		return m.Value
+	}
+	return m.RAP
+}
+
+// Outcome of a strategy for one deal
+type Decision struct {
+	Buy        bool
+	Reason     string
+	Confidence float64 //0 to 1
+}
+
+// Buy decision logic run against each deal
+type Strategy interface {
+	Name() string
+	Decide(event DealEvent, market *MarketContext) Decision
+}
+
+// Registry of strategies selectable from settings
+var strategies = map[string]func() (Strategy, error){
+	"margin-zscore": func() (Strategy, error) { return MarginZScoreStrategy{}, nil },
+	"margin":        func() (Strategy, error) { return MarginStrategy{}, nil },
+	"rules":         func() (Strategy, error) { return NewRuleStrategy(settings.BuyRules) },
+}
+
+// Builds strategies by name, rejecting unknown names
+func NewStrategies(names []string) ([]Strategy, error) {
+	var built []Strategy
+	for _, name := range names {
+		constructor, ok := strategies[name]
+		if !ok {
+			known := make([]string, 0, len(strategies))
+			for k := range strategies {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown strategy %q (available: %s)", name, strings.Join(known, ", "))
+		}
+		strategy, err := constructor()
+		if err != nil {
+			return nil, fmt.Errorf("strategy %q: %w", name, err)
+		}
+		built = append(built, strategy)
+	}
+	if len(built) == 0 {
+		return nil, fmt.Errorf("no strategies configured")
+	}
+	return built, nil
+}
+
+// Applies min_resale_gap to a buy decision (checked last, it costs a reseller request)
+func requireHeadroom(d Decision, event DealEvent, market *MarketContext) Decision {
+	if !d.Buy || settings.MinResaleGap <= 0 {
+		return d
+	}
+	gap, err := market.ResaleGap(event.Price)
+	switch {
+	case err != nil:
+		return Decision{Reason: "no resale gap: " + err.Error()}
+	case gap < settings.MinResaleGap:
+		return Decision{Reason: fmt.Sprintf("resale gap %.1f%% below %.1f%%", gap*100, settings.MinResaleGap*100)}
+	}
+	return d
+}
+
+// Confidence grows with the discount, reaching 0.5 at exactly the required margin
+func marginConfidence(price int, worth int, margin float64) float64 {
+	if worth <= 0 || margin <= 0 {
+		return 0
+	}
+	discount := float64(worth-price) / float64(worth)
+	return max(0, min(1, discount/(2*margin)))
+}
+
+// Margin filter on RAP/Value followed by z-score dip check (default)
+type MarginZScoreStrategy struct{}
+
+func (MarginZScoreStrategy) Name() string {
+	return "margin-zscore"
+}
+
+func (MarginZScoreStrategy) Decide(event DealEvent, market *MarketContext) Decision {
+	//Initial % margin filter of current price and RAP
+	if !BuyCheck(event.Price, market.RAP, market.Value, market.Margin) {
+		return Decision{Reason: fmt.Sprintf("below %.0f%% margin", market.Margin*100)}
+	}
+
+	//Deeper price anomaly dip check using precomputed z-score cutoffs
+	dip, reason := decisions.CheckDip(event.ID, float64(event.Price), market.Value, market.IsDemand, market.Margin)
+	if !dip {
+		return Decision{Reason: reason}
+	}
+	return requireHeadroom(Decision{
+		Buy:        true,
+		Reason:     fmt.Sprintf("margin below %d and %s", market.Worth(), reason),
+		Confidence: marginConfidence(event.Price, market.Worth(), market.Margin),
+	}, event, market)
+}
+
+// Margin filter on RAP/Value only
+type MarginStrategy struct{}
+
+func (MarginStrategy) Name() string {
+	return "margin"
+}
+
+func (MarginStrategy) Decide(event DealEvent, market *MarketContext) Decision {
+	if !BuyCheck(event.Price, market.RAP, market.Value, market.Margin) {
+		return Decision{Reason: fmt.Sprintf("below %.0f%% margin", market.Margin*100)}
+	}
+	return requireHeadroom(Decision{
+		Buy:        true,
+		Reason:     fmt.Sprintf("%.0f%% margin below %d", market.Margin*100, market.Worth()),
+		Confidence: marginConfidence(event.Price, market.Worth(), market.Margin),
+	}, event, market)
+}
+
+// Buy filter rules from settings; the first matching rule decides
+type RuleStrategy struct {
+	rules *rules.RuleSet
+}
+
+// Compiles rules into a strategy
+func NewRuleStrategy(list []rules.Rule) (*RuleStrategy, error) {
+	set, err := rules.CompileRules(list, rules.DealFields)
+	if err != nil {
+		return nil, err
+	}
+	return &RuleStrategy{rules: set}, nil
+}
+
+func (*RuleStrategy) Name() string {
+	return "rules"
+}
+
+func (s *RuleStrategy) Decide(event DealEvent, market *MarketContext) Decision {
+	fired, ok := s.rules.First(&dealEnv{event: event, market: market})
+	if !ok {
+		return Decision{Reason: "no rule matched"}
+	}
+	reason := fmt.Sprintf("rule %q fired (%s)", fired.Name, fired.When)
+	if fired.Action != rules.ActionBuy {
+		return Decision{Reason: reason}
+	}
+	return requireHeadroom(Decision{
+		Buy:        true,
+		Reason:     reason,
+		Confidence: marginConfidence(event.Price, market.Worth(), market.Margin),
+	}, event, market)
+}
+
+// Rule fields of a deal; costly fields are computed on first use
+type dealEnv struct {
+	event  DealEvent
+	market *MarketContext
+	cache  map[string]float64
+}
+
+func (e *dealEnv) Field(name string) float64 {
+	if v, ok := e.cache[name]; ok {
+		return v
+	}
+	v := e.field(name)
+	if e.cache == nil {
+		e.cache = make(map[string]float64)
+	}
+	e.cache[name] = v
+	return v
+}
+
+func (e *dealEnv) field(name string) float64 {
+	m := e.market
+	price := float64(e.event.Price)
+	flag := func(level int) float64 {
+		if level == 1 {
+			return 1
+		}
+		return 0
+	}
+	switch name {
+	case "price":
+		return price
+	case "rap":
+		return float64(m.RAP)
+	case "value":
+		return float64(m.Value)
+	case "worth":
+		return float64(m.Worth())
+	case "deal":
+		if m.Worth() <= 0 {
+			return math.NaN()
+		}
+		return (float64(m.Worth()) - price) / float64(m.Worth())
+	case "margin":
+		return m.Margin
+	case "demand":
+		return float64(m.Details.Demand)
+	case "trend":
+		return float64(m.Details.Trend)
+	case "projected":
+		return flag(m.Details.Projected)
+	case "hyped":
+		return flag(m.Details.Hyped)
+	case "rare":
+		return flag(m.Details.Rare)
+	case "mean", "sd", "z":
+		stats, ok := decisions.Stats(e.event.ID)
+		if !ok {
+			return math.NaN()
+		}
+		switch name {
+		case "mean":
+			return stats.Mean
+		case "sd":
+			return stats.StdDev
+		}
+		return (price - stats.Mean) / stats.StdDev
+	case "gap":
+		gap, err := m.ResaleGap(e.event.Price)
+		if err != nil {
+			return math.NaN()
+		}
+		return gap
+	case "volume30d":
+		return salesVolume(e.event.ID, 30)
+	}
+	return math.NaN()
+}
+
+// Copies sold in the days up to the latest cached sales sample, the window tools.SalesPerDay
+// uses (the cache is a snapshot, so the current time would leave it empty); NaN if not cached
+func salesVolume(id string, days int64) float64 {
+	sales := tools.SalesData[id]
+	if sales == nil || len(sales.Timestamp) == 0 {
+		return math.NaN()
+	}
+	since := sales.Timestamp[len(sales.Timestamp)-1] - days*tools.DayUnit
+	volume := 0
+	for i, t := range sales.Timestamp {
+		if t > since && i < len(sales.SalesVolume) {
+			volume += sales.SalesVolume[i]
+		}
+	}
+	return float64(volume)
+}
+
+// Strategy paired with its own simulated ledger
+type strategyRunner struct {
+	strategy Strategy
+	sim      *tools.TradeSimulator
+}
+
+// Logs each strategy's simulated spend and holdings for comparison
+func logStrategySummary(runners []strategyRunner) {
+	for _, r := range runners {
+		lots := 0
+		for _, held := range r.sim.GetPortfolio() {
+			lots += len(held)
+		}
+		log.Println("Strategy", r.strategy.Name(), "| Lots:", lots, "| Spent:", r.sim.RobuxSpent, "| Sold (net):", r.sim.RobuxGained)
+	}
+}
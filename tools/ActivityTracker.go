@@ -0,0 +1,140 @@
+package tools
+
+/*
+Tracks deal activities across polls. The deals feed is a rolling window, so the same
+activity shows up on many consecutive polls; the tracker lets each one through once,
+in timestamp order. The TTL runs from the activity's own timestamp: activities older
+than the TTL are skipped, so one still in the window after it is never let through again.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// One entry of the deals feed
+type Activity struct {
+	Timestamp int64
+	IsRAP     bool //RAP update (true) or best price update (false)
+	ID        string
+	Price     int //New RAP or best price
+}
+
+// Identity of an activity
+type activityKey struct {
+	timestamp int64
+	id        string
+	isRAP     bool
+	price     int
+}
+
+// Counts for one poll
+type PollCounts struct {
+	New       int
+	Repeated  int
+	Stale     int //Older than the TTL
+	Malformed int
+}
+
+func (c PollCounts) String() string {
+	return fmt.Sprintf("New: %d | Repeated: %d | Stale: %d | Malformed: %d", c.New, c.Repeated, c.Stale, c.Malformed)
+}
+
+// Remembers seen activities until they are older than a TTL
+type ActivityTracker struct {
+	ttl    time.Duration
+	mu     sync.Mutex
+	seen   map[activityKey]struct{}
+	totals PollCounts
+}
+
+// Constructor
+func NewActivityTracker(ttl time.Duration) *ActivityTracker {
+	return &ActivityTracker{
+		ttl:  ttl,
+		seen: make(map[activityKey]struct{}),
+	}
+}
+
+// Parses a raw [timestamp, isRAP, id, price] activity
+func ParseActivity(info []interface{}) (Activity, error) {
+	if len(info) < 4 {
+		return Activity{}, fmt.Errorf("activity has %d fields, want 4", len(info))
+	}
+	var nums [4]float64
+	for k := range nums {
+		f, ok := info[k].(float64)
+		if !ok {
+			return Activity{}, fmt.Errorf("activity field %d is %T, want number", k, info[k])
+		}
+		nums[k] = f
+	}
+	return Activity{
+		Timestamp: int64(nums[0]),
+		IsRAP:     nums[1] != 0,
+		ID:        strconv.Itoa(int(nums[2])),
+		Price:     int(nums[3]),
+	}, nil
+}
+
+// Returns activities not seen before and within the TTL, oldest first, with counts for this poll
+func (t *ActivityTracker) Track(activities [][]interface{}, now time.Time) ([]Activity, PollCounts) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	//Forget activities past their TTL; they are skipped as stale from now on
+	cutoff := now.Add(-t.ttl).Unix()
+	for key := range t.seen {
+		if key.timestamp < cutoff {
+			delete(t.seen, key)
+		}
+	}
+
+	var fresh []Activity
+	var counts PollCounts
+	for _, info := range activities {
+		activity, err := ParseActivity(info)
+		if err != nil {
+			counts.Malformed++
+			continue
+		}
+		if activity.Timestamp < cutoff {
+			counts.Stale++
+			continue
+		}
+		key := activityKey{activity.Timestamp, activity.ID, activity.IsRAP, activity.Price}
+		if _, ok := t.seen[key]; ok {
+			counts.Repeated++
+			continue
+		}
+		t.seen[key] = struct{}{}
+		counts.New++
+		fresh = append(fresh, activity)
+	}
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].Timestamp < fresh[j].Timestamp
+	})
+
+	t.totals.New += counts.New
+	t.totals.Repeated += counts.Repeated
+	t.totals.Stale += counts.Stale
+	t.totals.Malformed += counts.Malformed
+	return fresh, counts
+}
+
+// Counts across all polls
+func (t *ActivityTracker) Totals() PollCounts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.totals
+}
+
+// Number of activities currently remembered
+func (t *ActivityTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.seen)
+}
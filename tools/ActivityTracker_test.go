@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestActivityTracker(t *testing.T) {
+	start := time.Unix(10_000, 0)
+	ttl := 10 * time.Minute
+	raw := func(ts int64, isRAP float64, id float64, price float64) []interface{} {
+		return []interface{}{float64(ts), isRAP, id, price}
+	}
+	type poll struct {
+		at         time.Duration //After start
+		activities [][]interface{}
+		want       []Activity
+		counts     PollCounts
+	}
+	tests := []struct {
+		name  string
+		polls []poll
+	}{
+		{
+			name: "new, oldest first",
+			polls: []poll{{
+				activities: [][]interface{}{raw(9_990, 0, 2, 50), raw(9_980, 1, 1, 100)},
+				want:       []Activity{{Timestamp: 9_980, IsRAP: true, ID: "1", Price: 100}, {Timestamp: 9_990, ID: "2", Price: 50}},
+				counts:     PollCounts{New: 2},
+			}},
+		},
+		{
+			name: "repeated across polls",
+			polls: []poll{
+				{activities: [][]interface{}{raw(9_990, 0, 1, 50)}, want: []Activity{{Timestamp: 9_990, ID: "1", Price: 50}}, counts: PollCounts{New: 1}},
+				{at: time.Second, activities: [][]interface{}{raw(9_990, 0, 1, 50), raw(9_995, 0, 1, 45)}, want: []Activity{{Timestamp: 9_995, ID: "1", Price: 45}}, counts: PollCounts{New: 1, Repeated: 1}},
+			},
+		},
+		{
+			name: "malformed",
+			polls: []poll{{
+				activities: [][]interface{}{{float64(9_990), float64(0), float64(1)}, {"9990", float64(0), float64(1), float64(50)}, raw(9_990, 0, 1, 50)},
+				want:       []Activity{{Timestamp: 9_990, ID: "1", Price: 50}},
+				counts:     PollCounts{New: 1, Malformed: 2},
+			}},
+		},
+		{
+			name: "not re-emitted after the TTL",
+			polls: []poll{
+				{activities: [][]interface{}{raw(9_990, 0, 1, 50)}, want: []Activity{{Timestamp: 9_990, ID: "1", Price: 50}}, counts: PollCounts{New: 1}},
+				{at: ttl, activities: [][]interface{}{raw(9_990, 0, 1, 50)}, counts: PollCounts{Stale: 1}},
+				{at: 2 * ttl, activities: [][]interface{}{raw(9_990, 0, 1, 50)}, counts: PollCounts{Stale: 1}},
+			},
+		},
+		{
+			name: "older than the TTL on first sight",
+			polls: []poll{{
+				activities: [][]interface{}{raw(10_000-int64(ttl.Seconds())-1, 0, 1, 50)},
+				counts:     PollCounts{Stale: 1},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewActivityTracker(ttl)
+			var totals PollCounts
+			for k, p := range tt.polls {
+				got, counts := tracker.Track(p.activities, start.Add(p.at))
+				if !reflect.DeepEqual(got, p.want) {
+					t.Errorf("poll %d: activities %+v, want %+v", k, got, p.want)
+				}
+				if counts != p.counts {
+					t.Errorf("poll %d: counts %+v, want %+v", k, counts, p.counts)
+				}
+				totals.New += counts.New
+				totals.Repeated += counts.Repeated
+				totals.Stale += counts.Stale
+				totals.Malformed += counts.Malformed
+			}
+			if tracker.Totals() != totals {
+				t.Errorf("totals %+v, want %+v", tracker.Totals(), totals)
+			}
+		})
+	}
+}
+
+func TestActivityTrackerForgets(t *testing.T) {
+	tracker := NewActivityTracker(time.Minute)
+	now := time.Unix(10_000, 0)
+	tracker.Track([][]interface{}{{float64(9_990), float64(0), float64(1), float64(50)}}, now)
+	if tracker.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", tracker.Len())
+	}
+	tracker.Track(nil, now.Add(time.Minute))
+	if tracker.Len() != 0 {
+		t.Errorf("Len = %d after the TTL, want 0", tracker.Len())
+	}
+}
@@ -0,0 +1,140 @@
+package tools
+
+/*
+Persistent mapping of asset ids to collectible item and product ids. The mapping never
+changes for an item, so once resolved it is kept on disk and purchases skip the catalog
+round trip.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+)
+
+// Catalog ids of a collectible
+type CollectibleIDs struct {
+	CollectibleItemID string `json:"collectible_item_id"`
+	ProductID         int64  `json:"product_id"`
+}
+
+type CollectibleCache struct {
+	fileName string
+	mu       sync.RWMutex
+	ids      map[string]CollectibleIDs
+}
+
+// Cache used by GetCollectibleId (set by Configure)
+var collectibles = &CollectibleCache{ids: make(map[string]CollectibleIDs)}
+
+// Loads cache from JSON file (empty if missing or unreadable)
+func LoadCollectibleCache(fileName string) *CollectibleCache {
+	c := &CollectibleCache{fileName: fileName, ids: make(map[string]CollectibleIDs)}
+	bytes, err := os.ReadFile(fileName)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Println("Error reading collectible cache:", err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(bytes, &c.ids); err != nil {
+		log.Println("Error unmarshaling collectible cache from json:", err)
+		c.ids = make(map[string]CollectibleIDs)
+	}
+	return c
+}
+
+// Cached ids of an asset
+func (c *CollectibleCache) Get(assetId string) (CollectibleIDs, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ids, ok := c.ids[assetId]
+	return ids, ok
+}
+
+// Number of cached assets
+func (c *CollectibleCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.ids)
+}
+
+// Resolves ids from cache, fetching and storing them on a miss
+func (c *CollectibleCache) Resolve(assetId string) (CollectibleIDs, error) {
+	if ids, ok := c.Get(assetId); ok {
+		return ids, nil
+	}
+	ids, err := FetchCollectibleIDs(assetId)
+	if err != nil {
+		return ids, err
+	}
+	c.mu.Lock()
+	c.ids[assetId] = ids
+	c.mu.Unlock()
+	c.Store()
+	return ids, nil
+}
+
+/*
+Resolves every asset not yet cached using a pool of workers and saves once at the end.
+Returns the assets that could not be resolved with their errors.
+*/
+func (c *CollectibleCache) Preresolve(assetIds []string, workers int) map[string]error {
+	jobs := make(chan string)
+	failed := make(map[string]error)
+	var failedMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for assetId := range jobs {
+				ids, err := FetchCollectibleIDs(assetId)
+				if err != nil {
+					failedMu.Lock()
+					failed[assetId] = err
+					failedMu.Unlock()
+					continue
+				}
+				c.mu.Lock()
+				c.ids[assetId] = ids
+				c.mu.Unlock()
+			}
+		}()
+	}
+	for _, assetId := range assetIds {
+		if _, ok := c.Get(assetId); !ok {
+			jobs <- assetId
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	c.Store()
+	return failed
+}
+
+// Stores cache to JSON file
+func (c *CollectibleCache) Store() {
+	if c.fileName == "" {
+		return
+	}
+	c.mu.RLock()
+	jsonData, err := json.Marshal(c.ids)
+	c.mu.RUnlock()
+	if err != nil {
+		log.Println("Error marshalling collectible cache:", err)
+		return
+	}
+	if err := os.WriteFile(c.fileName, jsonData, 0644); err != nil {
+		log.Println("Error writing collectible cache to file:", err)
+	}
+}
+
+// Cache shared by purchase requests
+func Collectibles() *CollectibleCache {
+	return collectibles
+}
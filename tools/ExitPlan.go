@@ -0,0 +1,182 @@
+package tools
+
+/*
+Exit planning for held lots: a target list price and sell window per lot from its cost
+basis, the marketplace fee, the next forecast peak, liquidity and the hold period after
+buying. Plans are ranked by expected profit per day until the sale.
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Share of a resale price kept by the marketplace
+const MarketplaceFee = 0.30
+
+// Robux received for a sale at price after the marketplace fee
+func NetProceeds(price int) int {
+	return int(math.Floor(float64(price)*(1-MarketplaceFee) + 1e-9)) //Tolerate float error on exact amounts
+}
+
+// Lowest list price that recovers cost after the marketplace fee
+func BreakevenPrice(cost int) int {
+	price := int(math.Ceil(float64(cost) / (1 - MarketplaceFee)))
+	for price > 0 && NetProceeds(price-1) >= cost {
+		price--
+	}
+	for NetProceeds(price) < cost {
+		price++
+	}
+	return price
+}
+
+// One held copy to plan an exit for
+type ExitLot struct {
+	AssetID   string
+	Name      string
+	Source    string //inventory or a strategy's simulated ledger
+	Cost      int    //Price paid (current worth when unknown)
+	CostKnown bool
+	Serial    int64
+	Acquired  time.Time //Zero if unknown
+}
+
+// Market view of an item for exit planning
+type ExitMarket struct {
+	RAP         int
+	Value       int       //-1 if the item has no value
+	Forecast    float64   //Average forecast price over the horizon (NaN if none)
+	Peaks       []int     //Forecast peaks in days from now, ascending
+	PeakRatios  []float64 //Peak price relative to the forecast mean, paired with Peaks
+	SalesPerDay float64   //Recent sales volume
+}
+
+// Planner settings
+type ExitRules struct {
+	Hold    time.Duration //Time a bought item must be held before it can be resold
+	Window  time.Duration //Time a sell window stays open
+	Horizon int           //Days ahead to look for a forecast peak
+}
+
+// Proposed sale of one lot
+type ExitPlan struct {
+	ExitLot
+	Worth      int //max(RAP, value)
+	ListPrice  int
+	Breakeven  int
+	Net        int //Proceeds after the marketplace fee
+	Profit     int
+	PeakIn     int //Days to the forecast peak priced in (-1 if none)
+	DaysToSell float64
+	SellAfter  time.Time
+	SellBy     time.Time
+	Score      float64 //Profit per day until the expected sale (losses: the loss)
+	Reason     string
+}
+
+// Whether the sell window is open at now
+func (p ExitPlan) Open(now time.Time) bool {
+	return !now.Before(p.SellAfter) && !now.After(p.SellBy)
+}
+
+func (p ExitPlan) String() string {
+	line := fmt.Sprintf("%s (%s) | List: %d | Net: %d | Profit: %d", p.Name, p.AssetID, p.ListPrice, p.Net, p.Profit)
+	if !p.CostKnown {
+		line += " (cost unknown)"
+	}
+	line += " | Window: " + p.SellAfter.Format(time.DateOnly) + " to " + p.SellBy.Format(time.DateOnly)
+	if p.Serial > 0 {
+		line += fmt.Sprintf(" | #%d", p.Serial)
+	}
+	return line + " | " + p.Source + " | " + p.Reason
+}
+
+// Plans the sale of one lot
+func PlanExit(lot ExitLot, market ExitMarket, rules ExitRules, now time.Time) ExitPlan {
+	const day = 24 * time.Hour
+	plan := ExitPlan{ExitLot: lot, Worth: max(market.RAP, market.Value), PeakIn: -1}
+	target := plan.Worth
+	reason := "list at worth"
+
+	//Expected wait for a buyer at worth
+	plan.DaysToSell = math.Inf(1)
+	if market.SalesPerDay > 0 {
+		plan.DaysToSell = 1 / market.SalesPerDay
+	}
+
+	//Price in the next forecast peak above the mean, unless a sale before the window closes is unlikely
+	if !math.IsNaN(market.Forecast) && market.Forecast > 0 {
+		for i, peak := range market.Peaks {
+			if peak < 0 || peak > rules.Horizon || i >= len(market.PeakRatios) || market.PeakRatios[i] <= 1 {
+				continue
+			}
+			if plan.DaysToSell > rules.Window.Hours()/24 {
+				reason = "illiquid, list at worth"
+				break
+			}
+			if peakPrice := int(math.Round(market.Forecast * market.PeakRatios[i])); peakPrice > target {
+				target = peakPrice
+				plan.PeakIn = peak
+				reason = fmt.Sprintf("forecast peak in %d days", peak)
+			}
+			break
+		}
+	}
+
+	plan.Breakeven = BreakevenPrice(lot.Cost)
+	plan.ListPrice = max(target, 1)
+	if plan.ListPrice < plan.Breakeven {
+		reason += ", below breakeven"
+	}
+	plan.Net = NetProceeds(plan.ListPrice)
+	plan.Profit = plan.Net - lot.Cost
+
+	//Open the window ahead of the peak by the expected wait for a buyer, never before the hold ends
+	plan.SellAfter = now
+	if plan.PeakIn >= 0 {
+		lead := time.Duration(min(plan.DaysToSell, rules.Window.Hours()/24) * float64(day))
+		plan.SellAfter = now.Add(time.Duration(plan.PeakIn)*day - lead)
+	}
+	if !lot.Acquired.IsZero() && lot.Acquired.Add(rules.Hold).After(plan.SellAfter) {
+		plan.SellAfter = lot.Acquired.Add(rules.Hold)
+		reason += ", held until " + plan.SellAfter.Format(time.DateTime)
+	}
+	if plan.SellAfter.Before(now) {
+		plan.SellAfter = now
+	}
+	plan.SellBy = plan.SellAfter.Add(rules.Window)
+
+	//Losses are ranked by size alone so waiting never makes them look better
+	plan.Score = float64(plan.Profit)
+	if plan.Profit > 0 {
+		wait := plan.SellAfter.Sub(now).Hours()/24 + min(plan.DaysToSell, rules.Window.Hours()/24)
+		plan.Score /= 1 + wait
+	}
+	plan.Reason = reason
+	return plan
+}
+
+// Orders plans by score, best first
+func RankExits(plans []ExitPlan) {
+	sort.SliceStable(plans, func(i, j int) bool {
+		return plans[i].Score > plans[j].Score
+	})
+}
+
+// Average daily sales volume over the last days of a sales series
+func SalesPerDay(sales *Sales, days int64) float64 {
+	if sales == nil || len(sales.Timestamp) == 0 || days <= 0 {
+		return 0
+	}
+	since := sales.Timestamp[len(sales.Timestamp)-1] - days*DayUnit
+	volume := 0
+	for i, ts := range sales.Timestamp {
+		if ts > since && i < len(sales.SalesVolume) {
+			volume += sales.SalesVolume[i]
+		}
+	}
+	return float64(volume) / float64(days)
+}
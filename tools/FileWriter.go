@@ -5,11 +5,16 @@ Writes to a file
 */
 
 import (
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 )
 
+// Returned (wrapped) when a store file exists but does not parse
+var ErrCorruptFile = errors.New("corrupt file")
+
 func WriteLineToFile(fileName string, line string) {
 	currentTime := time.Now()
 
@@ -22,3 +27,34 @@ func WriteLineToFile(fileName string, line string) {
 
 	_, _ = f.WriteString(line + " | " + currentTime.Format("2006-01-02 15:04:05") + "\n")
 }
+
+// Replaces fileName with data through a temp file and a rename, so a crash never leaves it truncated
+func writeFileAtomic(fileName string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
+
+// Renames a file that could not be read to a timestamped name next to it, returns the new name
+func MoveAside(fileName string, now time.Time) (string, error) {
+	moved := fileName + ".corrupt-" + now.Format("20060102-150405")
+	return moved, os.Rename(fileName, moved)
+}
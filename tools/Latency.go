@@ -0,0 +1,284 @@
+package tools
+
+/*
+End-to-end latency of deals, from the moment Rolimons reports a listing to the purchase
+outcome. Each deal carries a trace of named stages; finished traces feed per-stage
+histograms in memory and are appended to a JSON lines file for later reports.
+Rolimons timestamps have one second resolution, so the first stage is coarse.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stage covering the whole trace
+const TotalStage = "total"
+
+// Stages of one deal, from its activity time to its outcome
+type Trace struct {
+	AssetID  string    `json:"asset_id"`
+	Price    int       `json:"price"`
+	Activity time.Time `json:"activity"` //Deal time reported by Rolimons
+	Outcome  string    `json:"outcome"`
+	Steps    []Step    `json:"steps"`
+}
+
+// Builds a trace from a timer started at the deal's activity time
+func NewTrace(assetId string, price int, timer *StepTimer, outcome string) Trace {
+	return Trace{
+		AssetID:  assetId,
+		Price:    price,
+		Activity: timer.start,
+		Outcome:  outcome,
+		Steps:    append([]Step(nil), timer.Steps...),
+	}
+}
+
+// Duration from the activity time to the last stage
+func (t Trace) Total() time.Duration {
+	var total time.Duration
+	for _, step := range t.Steps {
+		total += step.Duration
+	}
+	return total
+}
+
+// Histogram bucket bounds: 100µs doubling up to about an hour
+var latencyBounds = func() []time.Duration {
+	var bounds []time.Duration
+	for d := 100 * time.Microsecond; d < 2*time.Hour; d *= 2 {
+		bounds = append(bounds, d)
+	}
+	return bounds
+}()
+
+// Latency histogram with exponential buckets
+type Histogram struct {
+	counts []int64 //Last bucket holds everything above the highest bound
+	n      int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, len(latencyBounds)+1)}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(latencyBounds), func(i int) bool { return d <= latencyBounds[i] })
+	h.counts[i]++
+	h.n++
+}
+
+func (h *Histogram) Count() int64 {
+	return h.n
+}
+
+// Upper bound of the bucket holding quantile q (0 if empty)
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.n)))
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= max(rank, 1) {
+			if i == len(latencyBounds) {
+				return latencyBounds[i-1]
+			}
+			return latencyBounds[i]
+		}
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// Percentiles of one stage
+type StageLatency struct {
+	Stage         string
+	Count         int64
+	P50, P95, P99 time.Duration
+}
+
+func (s StageLatency) String() string {
+	return fmt.Sprintf("%-12s | Count: %6d | p50: %10s | p95: %10s | p99: %10s",
+		s.Stage, s.Count, roundLatency(s.P50), roundLatency(s.P95), roundLatency(s.P99))
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// Per-stage histograms of finished traces, optionally appended to a file
+type LatencyRecorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	stages map[string]*Histogram
+	order  []string //Stages in first-seen order
+}
+
+// Opens fileName for appending traces (histograms only if empty or unwritable)
+func NewLatencyRecorder(fileName string) *LatencyRecorder {
+	r := &LatencyRecorder{stages: make(map[string]*Histogram)}
+	if fileName == "" {
+		return r
+	}
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("Could not open trace file, keeping traces in memory:", err)
+		return r
+	}
+	r.file = file
+	return r
+}
+
+// Adds a finished trace to the histograms and the trace file
+func (r *LatencyRecorder) Record(trace Trace) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, step := range trace.Steps {
+		r.observe(step.Name, step.Duration)
+	}
+	r.observe(TotalStage, trace.Total())
+
+	if r.file == nil {
+		return
+	}
+	line, err := json.Marshal(trace)
+	if err != nil {
+		log.Println("Error marshalling trace:", err)
+		return
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		log.Println("Error writing trace to file:", err)
+	}
+}
+
+func (r *LatencyRecorder) observe(stage string, d time.Duration) {
+	h, ok := r.stages[stage]
+	if !ok {
+		h = NewHistogram()
+		r.stages[stage] = h
+		if stage != TotalStage {
+			r.order = append(r.order, stage)
+		}
+	}
+	h.Observe(d)
+}
+
+// Percentiles per stage (bucket upper bounds), in stage order
+func (r *LatencyRecorder) Latencies() []StageLatency {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	latencies := make([]StageLatency, 0, len(r.order)+1)
+	for _, stage := range append(r.order, TotalStage) {
+		h, ok := r.stages[stage]
+		if !ok {
+			continue
+		}
+		latencies = append(latencies, StageLatency{Stage: stage, Count: h.Count(), P50: h.Quantile(0.50), P95: h.Quantile(0.95), P99: h.Quantile(0.99)})
+	}
+	return latencies
+}
+
+// Closes the trace file
+func (r *LatencyRecorder) Close() {
+	if r == nil || r.file == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.file.Close(); err != nil {
+		log.Println("Error closing trace file:", err)
+	}
+	r.file = nil
+}
+
+// Reads traces from a JSON lines file, skipping malformed lines
+func ReadTraces(fileName string) ([]Trace, error) {
+	file, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var traces []Trace
+	skipped := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var trace Trace
+		if err := json.Unmarshal([]byte(line), &trace); err != nil {
+			skipped++
+			continue
+		}
+		traces = append(traces, trace)
+	}
+	if skipped > 0 {
+		log.Println("Skipped", skipped, "malformed traces in", fileName)
+	}
+	return traces, scanner.Err()
+}
+
+// Exact percentiles per stage over recorded traces, in stage order
+func TraceLatencies(traces []Trace) []StageLatency {
+	samples := make(map[string][]time.Duration)
+	var order []string
+	add := func(stage string, d time.Duration) {
+		if _, ok := samples[stage]; !ok && stage != TotalStage {
+			order = append(order, stage)
+		}
+		samples[stage] = append(samples[stage], d)
+	}
+	for _, trace := range traces {
+		for _, step := range trace.Steps {
+			add(step.Name, step.Duration)
+		}
+		add(TotalStage, trace.Total())
+	}
+
+	latencies := make([]StageLatency, 0, len(order)+1)
+	for _, stage := range append(order, TotalStage) {
+		s, ok := samples[stage]
+		if !ok {
+			continue
+		}
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		latencies = append(latencies, StageLatency{Stage: stage, Count: int64(len(s)), P50: percentile(s, 0.50), P95: percentile(s, 0.95), P99: percentile(s, 0.99)})
+	}
+	return latencies
+}
+
+// Nearest-rank percentile of sorted samples
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
@@ -0,0 +1,411 @@
+package tools
+
+/*
+Ledger of real acquisitions with their cost basis, persisted to a JSON file. Entries come
+from filled purchase orders and manual imports, are matched to inventory copies by UAID
+(user asset id), and are closed by sales or trades to give realized P&L.
+*/
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sources of ledger entries
+const (
+	SourcePurchase = "purchase" //Filled purchase order
+	SourceImport   = "import"   //Bought elsewhere, imported by hand
+	SourceTrade    = "trade"    //Received in a trade (cost is the value given up)
+)
+
+// Kinds of disposals
+const (
+	DisposalSale  = "sale"  //Sold on the marketplace (proceeds after the fee)
+	DisposalTrade = "trade" //Traded away (proceeds are the value received)
+)
+
+// How a lot left the inventory
+type Disposal struct {
+	Date      time.Time `json:"date"`
+	Kind      string    `json:"kind"`
+	Price     int       `json:"price"`    //Sale price or value received
+	Proceeds  int       `json:"proceeds"` //Robux received after the marketplace fee (trades: Price)
+	ImportKey string    `json:"import_key,omitempty"`
+}
+
+// One acquired copy of an item
+type LedgerEntry struct {
+	UAID      int64     `json:"uaid,omitempty"` //0 until matched to an inventory copy
+	AssetID   string    `json:"asset_id"`
+	Cost      int       `json:"cost"`
+	Serial    int64     `json:"serial,omitempty"`
+	Date      time.Time `json:"date"`
+	Source    string    `json:"source"`
+	OrderID   string    `json:"order_id,omitempty"`
+	ImportKey string    `json:"import_key,omitempty"` //Import row the entry came from
+	Disposal  *Disposal `json:"disposal,omitempty"`
+}
+
+// Whether the copy is still held
+func (e LedgerEntry) Open() bool {
+	return e.Disposal == nil
+}
+
+// Proceeds minus cost of a closed entry (0 while open)
+func (e LedgerEntry) Realized() int {
+	if e.Disposal == nil {
+		return 0
+	}
+	return e.Disposal.Proceeds - e.Cost
+}
+
+type Ledger struct {
+	fileName string
+	mu       sync.Mutex
+	entries  []*LedgerEntry
+}
+
+// Loads the ledger from a JSON file (empty if missing)
+func LoadLedger(fileName string) (*Ledger, error) {
+	l := &Ledger{fileName: fileName}
+	bytes, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, &l.entries); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrCorruptFile, fileName, err)
+	}
+	return l, nil
+}
+
+// Copies of all entries, oldest first
+func (l *Ledger) Entries() []LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	all := make([]LedgerEntry, 0, len(l.entries))
+	for _, e := range l.entries {
+		all = append(all, *e)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Date.Before(all[j].Date)
+	})
+	return all
+}
+
+// Open entry holding an inventory copy
+func (l *Ledger) ByUAID(uaid int64) (LedgerEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e.UAID == uaid && e.Open() {
+			return *e, true
+		}
+	}
+	return LedgerEntry{}, false
+}
+
+// Adds an acquisition unless its order, UAID or import row is already recorded
+// Entries without any of these keys are distinct copies, however alike
+func (l *Ledger) Add(entry LedgerEntry) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.add(entry) {
+		return false
+	}
+	l.store()
+	return true
+}
+
+func (l *Ledger) add(entry LedgerEntry) bool {
+	for _, e := range l.entries {
+		switch {
+		case entry.OrderID != "" && e.OrderID == entry.OrderID,
+			entry.UAID != 0 && e.UAID == entry.UAID,
+			entry.ImportKey != "" && e.ImportKey == entry.ImportKey:
+			return false
+		}
+	}
+	l.entries = append(l.entries, &entry)
+	return true
+}
+
+// Records filled purchase orders not yet in the ledger; returns how many were added
+func (l *Ledger) AddFromOrders(orders []Order) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	added := 0
+	for _, o := range orders {
+		if o.State != OrderFilled {
+			continue
+		}
+		if l.add(LedgerEntry{AssetID: o.AssetID, Cost: o.Price, Serial: o.Serial, Date: o.Created(), Source: SourcePurchase, OrderID: o.ID}) {
+			added++
+		}
+	}
+	if added > 0 {
+		l.store()
+	}
+	return added
+}
+
+// Closes an entry found by UAID, or else the oldest open copy of an asset; false if the import row is already recorded
+func (l *Ledger) dispose(key string, kind string, price int, date time.Time, importKey string) (bool, error) {
+	disposal := Disposal{Date: date, Kind: kind, Price: price, Proceeds: price, ImportKey: importKey}
+	switch kind {
+	case DisposalSale:
+		disposal.Proceeds = NetProceeds(price)
+	case DisposalTrade:
+	default:
+		return false, fmt.Errorf("unknown disposal %q (want %s or %s)", kind, DisposalSale, DisposalTrade)
+	}
+
+	for _, e := range l.entries {
+		if importKey != "" && e.Disposal != nil && e.Disposal.ImportKey == importKey {
+			return false, nil
+		}
+	}
+
+	var match *LedgerEntry
+	if uaid, err := strconv.ParseInt(key, 10, 64); err == nil && uaid != 0 {
+		for _, e := range l.entries {
+			if e.UAID == uaid {
+				match = e
+				break
+			}
+		}
+	}
+	if match == nil {
+		for _, e := range l.entries {
+			if e.AssetID != key {
+				continue
+			}
+			if e.Open() && (match == nil || e.Date.Before(match.Date)) {
+				match = e
+			}
+		}
+	}
+	if match == nil {
+		return false, fmt.Errorf("%s: no open lot", key)
+	}
+	if !match.Open() {
+		return false, fmt.Errorf("%s: already disposed on %s", key, match.Disposal.Date.Format(time.DateOnly))
+	}
+	match.Disposal = &disposal
+	return true, nil
+}
+
+// Result of matching the ledger against the inventory
+type LedgerSync struct {
+	Matched   int            //Entries newly assigned an inventory copy
+	Untracked map[string]int //Held copies per asset without a ledger entry
+	Missing   []LedgerEntry  //Open entries whose copy is no longer held
+}
+
+// Assigns inventory copies (asset id -> UAIDs) to open entries, oldest first
+func (l *Ledger) Sync(inventory map[string][]int64) LedgerSync {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := LedgerSync{Untracked: make(map[string]int)}
+
+	held := make(map[int64]bool)
+	claimed := make(map[int64]bool)
+	for _, uaids := range inventory {
+		for _, uaid := range uaids {
+			held[uaid] = true
+		}
+	}
+	for _, e := range l.entries {
+		if e.UAID == 0 || !e.Open() {
+			continue
+		}
+		if held[e.UAID] {
+			claimed[e.UAID] = true
+		} else {
+			result.Missing = append(result.Missing, *e)
+		}
+	}
+
+	for assetId, uaids := range inventory {
+		var free []int64
+		for _, uaid := range uaids {
+			if !claimed[uaid] {
+				free = append(free, uaid)
+			}
+		}
+		slices.Sort(free)
+
+		var unmatched []*LedgerEntry
+		for _, e := range l.entries {
+			if e.AssetID == assetId && e.UAID == 0 && e.Open() {
+				unmatched = append(unmatched, e)
+			}
+		}
+		sort.SliceStable(unmatched, func(i, j int) bool {
+			return unmatched[i].Date.Before(unmatched[j].Date)
+		})
+
+		//Copies of an asset are interchangeable here; sorting keeps the matching stable across syncs
+		n := min(len(free), len(unmatched))
+		for i := 0; i < n; i++ {
+			unmatched[i].UAID = free[i]
+		}
+		result.Matched += n
+		if len(free) > n {
+			result.Untracked[assetId] = len(free) - n
+		}
+	}
+	if result.Matched > 0 {
+		l.store()
+	}
+	return result
+}
+
+/*
+Imports acquisitions and disposals from CSV rows of action,item,price,date[,uaid]:
+  - buy / trade_in: item is the asset id, price the cost (value given up for trades)
+  - sell / trade_out: item is a UAID or asset id (oldest open copy), price the sale price or value received
+
+Dates are YYYY-MM-DD. Blank lines, # comments and a header row are skipped. Each row is
+keyed by its fields and how many identical rows came before it, so identical rows are
+separate copies while re-importing the same file adds nothing twice. Rows are all
+checked before any is applied; on an error nothing is imported.
+*/
+func (l *Ledger) Import(r io.Reader) (int, error) {
+	rows, err := parseImportRows(r)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	//Apply to a copy, kept only if every row applies
+	staged := &Ledger{entries: make([]*LedgerEntry, 0, len(l.entries))}
+	for _, e := range l.entries {
+		entry := *e
+		if e.Disposal != nil {
+			disposal := *e.Disposal
+			entry.Disposal = &disposal
+		}
+		staged.entries = append(staged.entries, &entry)
+	}
+
+	imported := 0
+	for _, row := range rows {
+		switch row.action {
+		case "buy", "trade_in":
+			entry := LedgerEntry{AssetID: row.item, Cost: row.price, Date: row.date, Source: SourceImport, UAID: row.uaid, ImportKey: row.key}
+			if row.action == "trade_in" {
+				entry.Source = SourceTrade
+			}
+			if staged.add(entry) {
+				imported++
+			}
+		case "sell", "trade_out":
+			kind := DisposalSale
+			if row.action == "trade_out" {
+				kind = DisposalTrade
+			}
+			disposed, err := staged.dispose(row.item, kind, row.price, row.date, row.key)
+			if err != nil {
+				return 0, fmt.Errorf("row %d: %w (nothing imported)", row.line, err)
+			}
+			if disposed {
+				imported++
+			}
+		}
+	}
+
+	l.entries = staged.entries
+	if imported > 0 {
+		l.store()
+	}
+	return imported, nil
+}
+
+// One validated import row
+type importRow struct {
+	line   int
+	action string
+	item   string
+	price  int
+	date   time.Time
+	uaid   int64
+	key    string //Fields plus the number of identical rows before it
+}
+
+// Reads and validates every import row
+func parseImportRows(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []importRow
+	seen := make(map[string]int)
+	for i, record := range records {
+		line := i + 1
+		if len(record) > 0 && strings.EqualFold(record[0], "action") {
+			continue
+		}
+		if len(record) < 4 {
+			return nil, fmt.Errorf("row %d: want action,item,price,date[,uaid]", line)
+		}
+		row := importRow{line: line, action: strings.ToLower(strings.TrimSpace(record[0])), item: strings.TrimSpace(record[1])}
+		switch row.action {
+		case "buy", "trade_in", "sell", "trade_out":
+		default:
+			return nil, fmt.Errorf("row %d: unknown action %q (want buy, trade_in, sell or trade_out)", line, row.action)
+		}
+		if row.price, err = strconv.Atoi(strings.TrimSpace(record[2])); err != nil || row.price < 0 {
+			return nil, fmt.Errorf("row %d: bad price %q", line, record[2])
+		}
+		if row.date, err = time.Parse(time.DateOnly, strings.TrimSpace(record[3])); err != nil {
+			return nil, fmt.Errorf("row %d: bad date %q", line, record[3])
+		}
+		if (row.action == "buy" || row.action == "trade_in") && len(record) > 4 && strings.TrimSpace(record[4]) != "" {
+			if row.uaid, err = strconv.ParseInt(strings.TrimSpace(record[4]), 10, 64); err != nil {
+				return nil, fmt.Errorf("row %d: bad uaid %q", line, record[4])
+			}
+		}
+
+		fields := strings.Join([]string{row.action, row.item, strconv.Itoa(row.price), row.date.Format(time.DateOnly), strconv.FormatInt(row.uaid, 10)}, ",")
+		seen[fields]++
+		row.key = fields + "#" + strconv.Itoa(seen[fields])
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Stores the ledger to its JSON file
+func (l *Ledger) store() {
+	if l.fileName == "" {
+		return
+	}
+	jsonData, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		log.Println("Error marshalling ledger:", err)
+		return
+	}
+	if err := writeFileAtomic(l.fileName, jsonData, 0644); err != nil {
+		log.Println("Error writing ledger to file:", err)
+	}
+}
@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLedgerFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "ledger.json")
+	l, err := LoadLedger(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := l.Import(strings.NewReader("buy,100,250,2026-01-02\nsell,100,400,2026-02-03\n"))
+	if err != nil || imported != 2 {
+		t.Fatalf("imported %d rows: %v", imported, err)
+	}
+
+	loaded, err := LoadLedger(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := loaded.Entries()
+	if len(entries) != 1 || entries[0].Cost != 250 || entries[0].Open() {
+		t.Fatalf("loaded %+v", entries)
+	}
+	if got, want := entries[0].Realized(), NetProceeds(400)-250; got != want {
+		t.Errorf("realized = %d, want %d", got, want)
+	}
+
+	//An unreadable ledger is an error, never an empty one
+	os.WriteFile(fileName, []byte(`[{"asset_id": `), 0644)
+	if l, err := LoadLedger(fileName); !errors.Is(err, ErrCorruptFile) || l != nil {
+		t.Errorf("corrupt ledger: %v, %v", l, err)
+	}
+}
+
+func TestLedgerImport(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "ledger.json")
+	l, _ := LoadLedger(fileName)
+	rows := "action,item,price,date,uaid\nbuy,100,250,2026-01-02\nbuy,100,250,2026-01-02\nbuy,200,80,2026-01-05,9001\n"
+
+	//Identical rows are separate copies
+	if imported, err := l.Import(strings.NewReader(rows)); err != nil || imported != 3 {
+		t.Fatalf("imported %d rows: %v", imported, err)
+	}
+	if n := len(l.Entries()); n != 3 {
+		t.Fatalf("%d entries, want 3", n)
+	}
+
+	//Importing the same file again adds nothing
+	if imported, err := l.Import(strings.NewReader(rows)); err != nil || imported != 0 {
+		t.Errorf("re-import: imported %d rows: %v", imported, err)
+	}
+
+	//A bad row imports nothing, leaving the file as it was
+	before, _ := os.ReadFile(fileName)
+	if imported, err := l.Import(strings.NewReader("buy,300,50,2026-02-01\nbuy,300,oops,2026-02-01\n")); err == nil || imported != 0 {
+		t.Errorf("bad price: imported %d rows: %v", imported, err)
+	}
+	if imported, err := l.Import(strings.NewReader("buy,300,50,2026-02-01\nsell,999,50,2026-02-02\n")); err == nil || imported != 0 {
+		t.Errorf("no open lot: imported %d rows: %v", imported, err)
+	}
+	after, _ := os.ReadFile(fileName)
+	if n := len(l.Entries()); n != 3 || string(before) != string(after) {
+		t.Errorf("failed imports changed the ledger: %d entries", n)
+	}
+}
+
+func TestLedgerDispose(t *testing.T) {
+	day := func(d int) string { return "2026-01-0" + strconv.Itoa(d) }
+	tests := []struct {
+		name    string
+		rows    []string
+		open    int
+		wantErr bool
+	}{
+		{name: "two sales close two copies", rows: []string{"buy,100,250," + day(1), "buy,100,300," + day(2), "sell,100,400," + day(5), "sell,100,400," + day(5)}, open: 0},
+		{name: "sale by uaid", rows: []string{"buy,100,250," + day(1), "buy,100,300," + day(2) + ",77", "sell,77,400," + day(5)}, open: 1},
+		{name: "sold twice by uaid", rows: []string{"buy,100,300," + day(2) + ",77", "sell,77,400," + day(5), "trade_out,77,400," + day(6)}, wantErr: true},
+		{name: "no open lot", rows: []string{"buy,100,250," + day(1), "sell,100,400," + day(5), "sell,100,400," + day(6)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := LoadLedger("")
+			_, err := l.Import(strings.NewReader(strings.Join(tt.rows, "\n")))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			open := 0
+			for _, e := range l.Entries() {
+				if e.Open() {
+					open++
+				}
+			}
+			if open != tt.open {
+				t.Errorf("%d open lots, want %d", open, tt.open)
+			}
+		})
+	}
+
+	//The oldest open copy is the one sold
+	l, _ := LoadLedger("")
+	l.Import(strings.NewReader("buy,100,300," + day(2) + "\nbuy,100,250," + day(1) + "\nsell,100,400," + day(5)))
+	for _, e := range l.Entries() {
+		if e.Open() != (e.Cost == 300) {
+			t.Errorf("lot bought for %d open = %v", e.Cost, e.Open())
+		}
+	}
+}
+
+func TestLedgerSync(t *testing.T) {
+	l, _ := LoadLedger("")
+	l.Import(strings.NewReader("buy,100,300,2026-01-02\nbuy,100,250,2026-01-01\nbuy,200,80,2026-01-01,55\n"))
+
+	//Free copies go to the oldest entries, in UAID order
+	sync := l.Sync(map[string][]int64{"100": {12, 11, 13}})
+	if sync.Matched != 2 || sync.Untracked["100"] != 1 {
+		t.Errorf("matched %d, untracked %v", sync.Matched, sync.Untracked)
+	}
+	if len(sync.Missing) != 1 || sync.Missing[0].UAID != 55 {
+		t.Errorf("missing %+v, want uaid 55", sync.Missing)
+	}
+	for _, e := range l.Entries() {
+		want := map[int]int64{250: 11, 300: 12, 80: 55}[e.Cost]
+		if e.UAID != want {
+			t.Errorf("lot bought for %d has uaid %d, want %d", e.Cost, e.UAID, want)
+		}
+	}
+
+	//Matching is stable once assigned
+	if sync := l.Sync(map[string][]int64{"100": {13, 12, 11}, "200": {55}}); sync.Matched != 0 || len(sync.Missing) != 0 {
+		t.Errorf("second sync: %+v", sync)
+	}
+	if e, ok := l.ByUAID(12); !ok || e.Cost != 300 {
+		t.Errorf("ByUAID(12) = %+v, %v", e, ok)
+	}
+}
@@ -0,0 +1,206 @@
+package tools
+
+/*
+Counters and gauges in the Prometheus text exposition format, so a long-running
+monitor can be scraped and charted without a client library.
+*/
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics of this process, served by the monitor's /metrics endpoint
+var Metrics = NewMetricSet()
+
+// API errors by endpoint and HTTP status ("network" when no response arrived)
+var apiErrors = Metrics.Counter("robolimited_api_errors_total", "Failed API requests by endpoint and status", "endpoint", "status")
+
+// Counts a failed API request; status 0 means no response was received
+func CountAPIError(endpoint string, status int) {
+	label := "network"
+	if status != 0 {
+		label = strconv.Itoa(status)
+	}
+	apiErrors.Inc(endpoint, label)
+}
+
+// API error counts so far
+func APIErrors() []Sample {
+	return apiErrors.Samples()
+}
+
+type MetricSet struct {
+	mu       sync.Mutex
+	families []*family
+	collect  []func()
+}
+
+func NewMetricSet() *MetricSet {
+	return &MetricSet{}
+}
+
+// Values of one metric name, keyed by joined label values
+type family struct {
+	name   string
+	help   string
+	kind   string //counter or gauge
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (s *MetricSet) add(name string, help string, kind string, labels []string) *family {
+	f := &family{name: name, help: help, kind: kind, labels: labels, values: make(map[string]float64)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.families {
+		if existing.name == name {
+			panic("metric registered twice: " + name)
+		}
+	}
+	s.families = append(s.families, f)
+	return f
+}
+
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values for %d labels", f.name, len(labelValues), len(f.labels)))
+	}
+	return strings.Join(labelValues, "\x00")
+}
+
+// Monotonic counter
+type Counter struct{ f *family }
+
+func (s *MetricSet) Counter(name string, help string, labels ...string) *Counter {
+	return &Counter{s.add(name, help, "counter", labels)}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Adds v (ignored if negative)
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := c.f.key(labelValues)
+	c.f.mu.Lock()
+	c.f.values[key] += v
+	c.f.mu.Unlock()
+}
+
+// One labelled value of a metric
+type Sample struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// Current values, ordered by label values
+func (c *Counter) Samples() []Sample {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	keys := c.f.keys()
+	samples := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		labels := make(map[string]string, len(c.f.labels))
+		for i, value := range strings.Split(key, "\x00") {
+			if i < len(c.f.labels) {
+				labels[c.f.labels[i]] = value
+			}
+		}
+		samples = append(samples, Sample{Labels: labels, Value: c.f.values[key]})
+	}
+	return samples
+}
+
+// Value that can go up and down
+type Gauge struct{ f *family }
+
+func (s *MetricSet) Gauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{s.add(name, help, "gauge", labels)}
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := g.f.key(labelValues)
+	g.f.mu.Lock()
+	g.f.values[key] = v
+	g.f.mu.Unlock()
+}
+
+// Registers fn to update gauges right before every scrape
+func (s *MetricSet) OnCollect(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collect = append(s.collect, fn)
+}
+
+// Writes all metrics in the text exposition format
+func (s *MetricSet) WriteTo(w io.Writer) (int64, error) {
+	s.mu.Lock()
+	collect := append([]func(){}, s.collect...)
+	families := append([]*family{}, s.families...)
+	s.mu.Unlock()
+
+	for _, fn := range collect {
+		fn()
+	}
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (f *family) write(b *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+
+	//Unlabelled metrics start at zero so they show up before the first update
+	if len(f.labels) == 0 && len(f.values) == 0 {
+		fmt.Fprintf(b, "%s 0\n", f.name)
+		return
+	}
+	for _, key := range f.keys() {
+		b.WriteString(f.name)
+		if len(f.labels) > 0 {
+			values := strings.Split(key, "\x00")
+			pairs := make([]string, len(f.labels))
+			for i, label := range f.labels {
+				pairs[i] = label + "=" + strconv.Quote(values[i])
+			}
+			b.WriteString("{" + strings.Join(pairs, ",") + "}")
+		}
+		b.WriteString(" " + strconv.FormatFloat(f.values[key], 'g', -1, 64) + "\n")
+	}
+}
+
+func (f *family) keys() []string {
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Serves the metrics over HTTP
+func (s *MetricSet) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := s.WriteTo(w); err != nil {
+			log.Println("Error writing metrics:", err)
+		}
+	})
+}
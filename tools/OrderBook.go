@@ -0,0 +1,116 @@
+package tools
+
+/*
+Summarizes the full reseller listing book of an item: depth at each price level,
+resale headroom below the next listing once one is bought, and serial spread.
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Listings sharing one price
+type PriceLevel struct {
+	Price      int
+	Count      int
+	Cumulative int //Listings at or below this price
+}
+
+// Listing counts per serial range
+type SerialBucket struct {
+	Label string
+	Max   int64 //Inclusive upper serial (0 = unbounded)
+	Count int
+}
+
+// Depth and spread metrics of an item's reseller listings
+type OrderBook struct {
+	Listings    []ResellerResponse //Sorted by ascending price
+	Levels      []PriceLevel
+	BestPrice   int
+	SecondPrice int     //0 if only one listing
+	Gap         int     //SecondPrice - BestPrice
+	GapRatio    float64 //Gap as fraction of SecondPrice (resale headroom)
+	Serials     []SerialBucket
+}
+
+// Builds an order book from reseller listings (any order)
+func BuildOrderBook(listings []ResellerResponse) *OrderBook {
+	book := &OrderBook{Listings: make([]ResellerResponse, len(listings))}
+	copy(book.Listings, listings)
+	sort.SliceStable(book.Listings, func(i, j int) bool {
+		return book.Listings[i].Price < book.Listings[j].Price
+	})
+
+	//Group listings into price levels
+	for _, l := range book.Listings {
+		n := len(book.Levels)
+		if n > 0 && book.Levels[n-1].Price == l.Price {
+			book.Levels[n-1].Count++
+			book.Levels[n-1].Cumulative++
+			continue
+		}
+		cumulative := 1
+		if n > 0 {
+			cumulative += book.Levels[n-1].Cumulative
+		}
+		book.Levels = append(book.Levels, PriceLevel{Price: l.Price, Count: 1, Cumulative: cumulative})
+	}
+
+	if len(book.Listings) > 0 {
+		book.BestPrice = book.Listings[0].Price
+	}
+	if len(book.Listings) > 1 {
+		book.SecondPrice = book.Listings[1].Price
+		book.Gap = book.SecondPrice - book.BestPrice
+		if book.SecondPrice > 0 {
+			book.GapRatio = float64(book.Gap) / float64(book.SecondPrice)
+		}
+	}
+
+	//Serial distribution
+	book.Serials = []SerialBucket{
+		{Label: "#1-10", Max: 10},
+		{Label: "#11-100", Max: 100},
+		{Label: "#101-1000", Max: 1000},
+		{Label: "#1001+", Max: 0},
+	}
+	for _, l := range book.Listings {
+		for i := range book.Serials {
+			if book.Serials[i].Max == 0 || l.SerialNumber <= book.Serials[i].Max {
+				book.Serials[i].Count++
+				break
+			}
+		}
+	}
+	return book
+}
+
+// Number of listings
+func (b *OrderBook) Count() int {
+	return len(b.Listings)
+}
+
+// Headroom left if listing is bought: the cheapest other listing's price minus its price,
+// as fraction of that other price (negative if a cheaper copy stays up)
+// A lone listing has no competitor to undercut, so its headroom is unbounded
+func (b *OrderBook) ResaleGap(listing ResellerResponse) float64 {
+	for _, l := range b.Listings {
+		if l.CollectibleItemInstanceID == listing.CollectibleItemInstanceID {
+			continue
+		}
+		if l.Price <= 0 {
+			return 0
+		}
+		return float64(l.Price-listing.Price) / float64(l.Price)
+	}
+	return math.Inf(1)
+}
+
+// One-line summary for console output
+func (b *OrderBook) String() string {
+	return fmt.Sprintf("Listings: %d | Best: %d | Second: %d | Gap: %d (%.1f%%)",
+		b.Count(), b.BestPrice, b.SecondPrice, b.Gap, b.GapRatio*100)
+}
@@ -0,0 +1,30 @@
+package tools
+
+import (
+	"math"
+	"testing"
+)
+
+func TestResaleGap(t *testing.T) {
+	listing := func(id string, price int) ResellerResponse {
+		return ResellerResponse{CollectibleItemInstanceID: id, Price: price}
+	}
+	book := BuildOrderBook([]ResellerResponse{listing("a", 80), listing("b", 100), listing("c", 120)})
+	tests := []struct {
+		name    string
+		book    *OrderBook
+		listing ResellerResponse
+		want    float64
+	}{
+		{name: "cheapest, next is second", book: book, listing: listing("a", 80), want: 0.2},
+		{name: "not cheapest, cheaper copy stays up", book: book, listing: listing("b", 100), want: -0.25},
+		{name: "lone listing", book: BuildOrderBook([]ResellerResponse{listing("a", 80)}), listing: listing("a", 80), want: math.Inf(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.book.ResaleGap(tt.listing); math.Abs(got-tt.want) > 1e-9 && got != tt.want {
+				t.Errorf("ResaleGap = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package tools
+
+/*
+Purchase orders as a persisted state machine:
+
+	intent -> submitted -> pending -> filled
+	                    \-> failed / unknown -> filled / failed
+
+A purchase only counts as filled once the item shows up in our inventory. Orders left
+open by a timeout or a crash are resolved by reconciling against the inventory.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OrderState string
+
+const (
+	OrderIntent    OrderState = "intent"    //Decided to buy, request not sent yet
+	OrderSubmitted OrderState = "submitted" //Request sent, no response yet
+	OrderPending   OrderState = "pending"   //Accepted by the API, not yet seen in inventory
+	OrderFilled    OrderState = "filled"    //Confirmed in inventory
+	OrderFailed    OrderState = "failed"    //Rejected, or never arrived
+	OrderUnknown   OrderState = "unknown"   //Outcome lost (network error, timeout or crash)
+)
+
+// Allowed state changes
+var orderTransitions = map[OrderState][]OrderState{
+	OrderIntent:    {OrderSubmitted, OrderFailed},
+	OrderSubmitted: {OrderPending, OrderFilled, OrderFailed, OrderUnknown},
+	OrderPending:   {OrderFilled, OrderFailed, OrderUnknown},
+	OrderUnknown:   {OrderPending, OrderFilled, OrderFailed},
+}
+
+// Whether no further transitions are possible
+func (s OrderState) Final() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+// One state change of an order
+type OrderEvent struct {
+	State OrderState `json:"state"`
+	Time  time.Time  `json:"time"`
+	Note  string     `json:"note,omitempty"`
+}
+
+// Single purchase attempt
+type Order struct {
+	ID                string       `json:"id"` //Idempotency key of the purchase request
+	AssetID           string       `json:"asset_id"`
+	CollectibleItemID string       `json:"collectible_item_id"`
+	InstanceID        string       `json:"instance_id"`
+	Price             int          `json:"price"`
+	Serial            int64        `json:"serial,omitempty"`
+	HeldBefore        int          `json:"held_before"` //Copies in inventory when ordered (-1 if unknown)
+	State             OrderState   `json:"state"`
+	History           []OrderEvent `json:"history"`
+}
+
+// Time the order was created
+func (o *Order) Created() time.Time {
+	if len(o.History) == 0 {
+		return time.Time{}
+	}
+	return o.History[0].Time
+}
+
+// Time of the latest state change
+func (o *Order) Updated() time.Time {
+	if len(o.History) == 0 {
+		return time.Time{}
+	}
+	return o.History[len(o.History)-1].Time
+}
+
+func (o *Order) String() string {
+	line := fmt.Sprintf("%s | %s | %s for %d", o.Created().Format(time.DateTime), o.State, o.AssetID, o.Price)
+	if o.Serial > 0 {
+		line += " #" + strconv.FormatInt(o.Serial, 10)
+	}
+	if n := len(o.History); n > 0 && o.History[n-1].Note != "" {
+		line += " | " + o.History[n-1].Note
+	}
+	return line
+}
+
+// Orders persisted to a JSON file
+type OrderStore struct {
+	fileName string
+	mu       sync.Mutex
+	orders   []*Order
+}
+
+// Loads orders from JSON file (empty if missing)
+func LoadOrderStore(fileName string) (*OrderStore, error) {
+	s := &OrderStore{fileName: fileName}
+	bytes, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, &s.orders); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrCorruptFile, fileName, err)
+	}
+	return s, nil
+}
+
+// Records a new order in the intent state
+func (s *OrderStore) Create(order Order, now time.Time) *Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order.State = OrderIntent
+	order.History = []OrderEvent{{State: OrderIntent, Time: now}}
+	s.orders = append(s.orders, &order)
+	s.store()
+	return &order
+}
+
+// Moves an order to a new state, rejecting transitions the state machine does not allow
+func (s *OrderStore) Transition(id string, state OrderState, note string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.orders {
+		if o.ID != id {
+			continue
+		}
+		allowed := false
+		for _, next := range orderTransitions[o.State] {
+			allowed = allowed || next == state
+		}
+		if !allowed {
+			return fmt.Errorf("order %s: cannot go from %s to %s", id, o.State, state)
+		}
+		o.State = state
+		o.History = append(o.History, OrderEvent{State: state, Time: now, Note: note})
+		s.store()
+		return nil
+	}
+	return fmt.Errorf("order %s: not found", id)
+}
+
+// Copies of all orders, oldest first
+func (s *OrderStore) All() []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make([]Order, 0, len(s.orders))
+	for _, o := range s.orders {
+		all = append(all, *o)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Created().Before(all[j].Created())
+	})
+	return all
+}
+
+// Stores orders to JSON file
+func (s *OrderStore) store() {
+	if s.fileName == "" {
+		return
+	}
+	jsonData, err := json.MarshalIndent(s.orders, "", "  ")
+	if err != nil {
+		log.Println("Error marshalling orders:", err)
+		return
+	}
+	if err := writeFileAtomic(s.fileName, jsonData, 0644); err != nil {
+		log.Println("Error writing orders to file:", err)
+	}
+}
+
+/*
+Resolves open orders against current inventory holdings:
+  - intents older than timeout were never sent (crash) and fail
+  - orders whose asset count rose above the count when ordered are filled
+    (oldest first, one copy each); copies of orders filled after an order was
+    placed, in this pass or earlier ones, are not counted for it again; orders
+    placed before any inventory snapshot have no count to compare with and are
+    never filled this way
+  - submitted/pending orders older than timeout become unknown
+  - unknown orders older than twice the timeout fail as never arrived
+
+Returns the number of orders changed.
+*/
+func (s *OrderStore) Reconcile(holdings map[string]int, now time.Time, timeout time.Duration) int {
+	all := s.All()
+	changed := 0
+	filledAt := make(map[string][]time.Time) //Fill times per asset, each holding one copy
+	for _, o := range all {
+		if o.State == OrderFilled {
+			filledAt[o.AssetID] = append(filledAt[o.AssetID], o.Updated())
+		}
+	}
+	for _, o := range all {
+		if o.State.Final() {
+			continue
+		}
+		age := now.Sub(o.Created())
+
+		if o.State == OrderIntent {
+			if age > timeout {
+				changed += s.apply(o.ID, OrderFailed, "never submitted", now)
+			}
+			continue
+		}
+
+		//Copies that arrived for other orders since this one's count was taken
+		held := holdings[o.AssetID]
+		claimed := 0
+		for _, t := range filledAt[o.AssetID] {
+			if t.After(o.Created()) {
+				claimed++
+			}
+		}
+		if o.HeldBefore >= 0 && held-claimed > o.HeldBefore {
+			if s.apply(o.ID, OrderFilled, "confirmed in inventory ("+strconv.Itoa(held)+" held)", now) == 1 {
+				filledAt[o.AssetID] = append(filledAt[o.AssetID], now)
+				changed++
+			}
+			continue
+		}
+
+		switch {
+		case o.State == OrderUnknown && age > 2*timeout:
+			changed += s.apply(o.ID, OrderFailed, "not in inventory after "+(2*timeout).String(), now)
+		case o.State != OrderUnknown && age > timeout:
+			changed += s.apply(o.ID, OrderUnknown, "not in inventory after "+timeout.String(), now)
+		}
+	}
+	return changed
+}
+
+func (s *OrderStore) apply(id string, state OrderState, note string, now time.Time) int {
+	if err := s.Transition(id, state, note, now); err != nil {
+		log.Println("Could not reconcile order:", err)
+		return 0
+	}
+	return 1
+}
+
+// Summary of order counts by state
+func (s *OrderStore) Summary() string {
+	counts := make(map[OrderState]int)
+	for _, o := range s.All() {
+		counts[o.State]++
+	}
+	var parts []string
+	for _, state := range []OrderState{OrderIntent, OrderSubmitted, OrderPending, OrderUnknown, OrderFilled, OrderFailed} {
+		parts = append(parts, fmt.Sprintf("%s: %d", strings.ToUpper(string(state[:1]))+string(state[1:]), counts[state]))
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeout := 10 * time.Minute
+	tests := []struct {
+		name       string
+		heldBefore int
+		state      OrderState
+		holdings   map[string]int
+		age        time.Duration
+		want       OrderState
+	}{
+		{name: "copy arrived", heldBefore: 1, state: OrderPending, holdings: map[string]int{"1": 2}, age: time.Minute, want: OrderFilled},
+		{name: "not arrived yet", heldBefore: 1, state: OrderPending, holdings: map[string]int{"1": 1}, age: time.Minute, want: OrderPending},
+		{name: "not arrived in time", heldBefore: 1, state: OrderPending, holdings: map[string]int{"1": 1}, age: 2 * timeout, want: OrderUnknown},
+		{name: "no snapshot when ordered", heldBefore: -1, state: OrderPending, holdings: map[string]int{"1": 1}, age: time.Minute, want: OrderPending},
+		{name: "no snapshot, timed out", heldBefore: -1, state: OrderPending, holdings: map[string]int{"1": 3}, age: 2 * timeout, want: OrderUnknown},
+		{name: "unknown never arrived", heldBefore: 0, state: OrderUnknown, holdings: map[string]int{}, age: 3 * timeout, want: OrderFailed},
+		{name: "intent never sent", heldBefore: 0, state: OrderIntent, holdings: map[string]int{"1": 1}, age: 2 * timeout, want: OrderFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := LoadOrderStore("")
+			o := s.Create(Order{ID: "key", AssetID: "1", HeldBefore: tt.heldBefore}, start)
+			if tt.state != OrderIntent {
+				path := map[OrderState][]OrderState{
+					OrderPending: {OrderSubmitted, OrderPending},
+					OrderUnknown: {OrderSubmitted, OrderUnknown},
+				}[tt.state]
+				for _, state := range path {
+					if err := s.Transition(o.ID, state, "", start); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			s.Reconcile(tt.holdings, start.Add(tt.age), timeout)
+			if got := s.All()[0].State; got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileClaimsOneCopyEach(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, _ := LoadOrderStore("")
+	for _, id := range []string{"a", "b"} {
+		o := s.Create(Order{ID: id, AssetID: "1", HeldBefore: 0}, start)
+		s.Transition(o.ID, OrderSubmitted, "", start)
+		s.Transition(o.ID, OrderPending, "", start)
+	}
+	if changed := s.Reconcile(map[string]int{"1": 1}, start.Add(time.Minute), time.Hour); changed != 1 {
+		t.Fatalf("changed = %d, want 1", changed)
+	}
+	all := s.All()
+	if all[0].State != OrderFilled || all[1].State != OrderPending {
+		t.Errorf("states = %s, %s, want filled, pending", all[0].State, all[1].State)
+	}
+}
+
+func TestReconcileAcrossPasses(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, _ := LoadOrderStore("")
+	for _, id := range []string{"a", "b"} {
+		o := s.Create(Order{ID: id, AssetID: "1", HeldBefore: 1}, start)
+		s.Transition(o.ID, OrderSubmitted, "", start)
+		s.Transition(o.ID, OrderPending, "", start)
+	}
+	states := func() (OrderState, OrderState) {
+		all := s.All()
+		return all[0].State, all[1].State
+	}
+	passes := []struct {
+		held   int
+		first  OrderState
+		second OrderState
+	}{
+		{held: 2, first: OrderFilled, second: OrderPending},
+		{held: 2, first: OrderFilled, second: OrderPending}, //Same copy, not counted again
+		{held: 3, first: OrderFilled, second: OrderFilled},
+	}
+	for k, pass := range passes {
+		s.Reconcile(map[string]int{"1": pass.held}, start.Add(time.Duration(k+1)*time.Minute), time.Hour)
+		if first, second := states(); first != pass.first || second != pass.second {
+			t.Errorf("pass %d: states = %s, %s, want %s, %s", k+1, first, second, pass.first, pass.second)
+		}
+	}
+}
+
+func TestOrderStoreFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "orders.json")
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s, err := LoadOrderStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Create(Order{ID: "key", AssetID: "1", Price: 100}, now)
+
+	loaded, err := LoadOrderStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all := loaded.All(); len(all) != 1 || all[0].ID != "key" || all[0].Price != 100 {
+		t.Errorf("loaded %+v", all)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("%d files left in the store directory, want 1", len(entries))
+	}
+
+	//Unreadable history is reported, and can be moved aside for a new one
+	os.WriteFile(fileName, []byte(`[{"id": `), 0644)
+	if _, err := LoadOrderStore(fileName); !errors.Is(err, ErrCorruptFile) {
+		t.Fatalf("err = %v, want ErrCorruptFile", err)
+	}
+	moved, err := MoveAside(fileName, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(moved); err != nil {
+		t.Error(err)
+	}
+	if s, err := LoadOrderStore(fileName); err != nil || len(s.All()) != 0 {
+		t.Errorf("after moving aside: %v, %d orders", err, len(s.All()))
+	}
+}
@@ -0,0 +1,81 @@
+package tools
+
+/*
+Valuations of the ledger over time, appended as JSON lines each time the portfolio
+report runs, so performance can be followed between runs.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Valuation of the ledger at one time
+type PortfolioSnapshot struct {
+	Time       time.Time `json:"time"`
+	Lots       int       `json:"lots"`        //Open lots
+	Cost       int       `json:"cost"`        //Cost basis of open lots
+	AtRAP      int       `json:"at_rap"`      //Open lots at RAP
+	AtValue    int       `json:"at_value"`    //Open lots at value (RAP for items without one)
+	AtForecast int       `json:"at_forecast"` //Open lots at forecast price (RAP without a forecast)
+	Realized   int       `json:"realized"`    //Realized P&L to date
+}
+
+// Unrealized plus realized P&L at RAP
+func (s PortfolioSnapshot) TotalPnL() int {
+	return s.AtRAP - s.Cost + s.Realized
+}
+
+// Appends a snapshot to a JSON lines file
+func AppendSnapshot(fileName string, snapshot PortfolioSnapshot) error {
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Reads snapshots from a JSON lines file, skipping malformed lines
+func ReadSnapshots(fileName string) ([]PortfolioSnapshot, error) {
+	file, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var snapshots []PortfolioSnapshot
+	skipped := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var snapshot PortfolioSnapshot
+		if err := json.Unmarshal([]byte(line), &snapshot); err != nil {
+			skipped++
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if skipped > 0 {
+		log.Println("Skipped", skipped, "malformed snapshots in", fileName)
+	}
+	return snapshots, scanner.Err()
+}
@@ -0,0 +1,174 @@
+package tools
+
+/*
+Registry of in-flight and recent purchases, persisted across restarts. Guards against
+buying the same listing instance twice and against rebuying an item within a cooldown.
+Purchases are scoped by ledger ("live" or a simulator name) so simulated strategies do
+not block each other or real trades.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Scope of real purchases
+const LiveScope = "live"
+
+// How long bought instance ids are remembered when the cooldown is shorter
+const instanceRetention = 7 * 24 * time.Hour
+
+// Reason a purchase was refused as a duplicate
+type DuplicateError struct {
+	Scope  string
+	Reason string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("duplicate purchase (%s): %s", e.Scope, e.Reason)
+}
+
+// One completed purchase
+type PurchaseRecord struct {
+	Scope      string    `json:"scope"`
+	AssetID    string    `json:"asset_id"`
+	InstanceID string    `json:"instance_id,omitempty"` //Empty for simulated buys
+	Time       time.Time `json:"time"`
+}
+
+type PurchaseRegistry struct {
+	fileName string
+	cooldown time.Duration
+	mu       sync.Mutex
+	records  []PurchaseRecord
+	inFlight map[string]bool //Scoped asset and instance keys being bought
+}
+
+// Loads registry from JSON file (empty if missing)
+// An unreadable file is an error: starting empty would lift the duplicate guard
+func LoadPurchaseRegistry(fileName string, cooldown time.Duration) (*PurchaseRegistry, error) {
+	r := &PurchaseRegistry{
+		fileName: fileName,
+		cooldown: cooldown,
+		inFlight: make(map[string]bool),
+	}
+	bytes, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, &r.records); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrCorruptFile, fileName, err)
+	}
+	return r, nil
+}
+
+func assetKey(scope string, assetId string) string {
+	return scope + "/asset/" + assetId
+}
+
+func instanceKey(scope string, instanceId string) string {
+	return scope + "/instance/" + instanceId
+}
+
+/*
+Marks a purchase as in flight, or returns a DuplicateError if the instance was already
+bought or is being bought, or the asset was bought within the cooldown.
+Every successful Reserve must be followed by Commit or Release.
+*/
+func (r *PurchaseRegistry) Reserve(scope string, assetId string, instanceId string, now time.Time) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.inFlight[assetKey(scope, assetId)] {
+		return &DuplicateError{Scope: scope, Reason: "asset " + assetId + " already being bought"}
+	}
+	if instanceId != "" && r.inFlight[instanceKey(scope, instanceId)] {
+		return &DuplicateError{Scope: scope, Reason: "instance " + instanceId + " already being bought"}
+	}
+	for _, rec := range r.records {
+		if rec.Scope != scope {
+			continue
+		}
+		if instanceId != "" && rec.InstanceID == instanceId {
+			return &DuplicateError{Scope: scope, Reason: fmt.Sprintf("instance %s already bought at %s", instanceId, rec.Time.Format(time.RFC3339))}
+		}
+		if rec.AssetID == assetId && now.Sub(rec.Time) < r.cooldown {
+			return &DuplicateError{Scope: scope, Reason: fmt.Sprintf("asset %s bought %s ago (cooldown %s)", assetId, now.Sub(rec.Time).Round(time.Second), r.cooldown)}
+		}
+	}
+
+	r.inFlight[assetKey(scope, assetId)] = true
+	if instanceId != "" {
+		r.inFlight[instanceKey(scope, instanceId)] = true
+	}
+	return nil
+}
+
+// Records a reserved purchase as completed and saves the registry
+func (r *PurchaseRegistry) Commit(scope string, assetId string, instanceId string, now time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.release(scope, assetId, instanceId)
+	r.records = append(r.records, PurchaseRecord{Scope: scope, AssetID: assetId, InstanceID: instanceId, Time: now})
+	r.prune(now)
+	r.store()
+}
+
+// Drops a reservation whose purchase did not go through
+func (r *PurchaseRegistry) Release(scope string, assetId string, instanceId string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release(scope, assetId, instanceId)
+}
+
+func (r *PurchaseRegistry) release(scope string, assetId string, instanceId string) {
+	delete(r.inFlight, assetKey(scope, assetId))
+	if instanceId != "" {
+		delete(r.inFlight, instanceKey(scope, instanceId))
+	}
+}
+
+// Forgets records past both the cooldown and the instance retention
+func (r *PurchaseRegistry) prune(now time.Time) {
+	keep := max(r.cooldown, instanceRetention)
+	kept := r.records[:0]
+	for _, rec := range r.records {
+		if now.Sub(rec.Time) < keep {
+			kept = append(kept, rec)
+		}
+	}
+	r.records = kept
+}
+
+// Stores registry to JSON file
+func (r *PurchaseRegistry) store() {
+	if r.fileName == "" {
+		return
+	}
+	jsonData, err := json.Marshal(r.records)
+	if err != nil {
+		log.Println("Error marshalling purchase registry:", err)
+		return
+	}
+	if err := writeFileAtomic(r.fileName, jsonData, 0644); err != nil {
+		log.Println("Error writing purchase registry to file:", err)
+	}
+}
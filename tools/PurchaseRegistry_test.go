@@ -0,0 +1,39 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPurchaseRegistryFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "purchases.json")
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	r, err := LoadPurchaseRegistry(fileName, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reserve(LiveScope, "1", "instance", now); err != nil {
+		t.Fatal(err)
+	}
+	r.Commit(LiveScope, "1", "instance", now)
+
+	//The guard survives a restart
+	loaded, err := LoadPurchaseRegistry(fileName, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dup *DuplicateError
+	if err := loaded.Reserve(LiveScope, "1", "other", now.Add(time.Minute)); !errors.As(err, &dup) {
+		t.Errorf("rebuy within cooldown after reload: %v, want DuplicateError", err)
+	}
+
+	//An unreadable registry is an error, never an empty guard
+	os.WriteFile(fileName, []byte(`{"live/asset/1": `), 0644)
+	if r, err := LoadPurchaseRegistry(fileName, time.Hour); !errors.Is(err, ErrCorruptFile) || r != nil {
+		t.Errorf("corrupt registry: %v, %v", r, err)
+	}
+}
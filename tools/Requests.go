@@ -28,6 +28,9 @@ var proxyIndex int
 
 var userAgents []string
 
+// Runtime settings applied through Configure
+var settings *config.Settings
+
 // ItemDetails JSON structure
 type ItemDetails struct {
 	ItemCount int                      `json:"item_count"`
@@ -58,6 +61,7 @@ func GetLimitedData() *ItemDetails {
 	//Make a GET request to the Rolimons API
 	resp, err := http.Get(apiURL)
 	if err != nil {
+		CountAPIError("item_details", 0)
 		log.Printf("Error making HTTP request: %v", err)
 		return nil
 	}
@@ -66,6 +70,7 @@ func GetLimitedData() *ItemDetails {
 	//Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		CountAPIError("item_details", 0)
 		log.Printf("Error reading response body: %v", err)
 		return nil
 	}
@@ -74,6 +79,7 @@ func GetLimitedData() *ItemDetails {
 	var itemDetails ItemDetails
 	err = json.Unmarshal(body, &itemDetails)
 	if err != nil {
+		CountAPIError("item_details", resp.StatusCode)
 		log.Printf("Error unmarshalling JSON: %v", err)
 		return nil
 	}
@@ -87,7 +93,7 @@ func GetDealsData() *DealDetails {
 
 	//Send request through cycled proxies
 	client := GlobalClient
-	if config.RotateProxies {
+	if settings.RotateProxies {
 		proxyURL := proxies[proxyIndex]
 		proxyIndex = (proxyIndex + 1) % len(proxies)
 
@@ -105,6 +111,7 @@ func GetDealsData() *DealDetails {
 	//Make GET request to API
 	resp, err := client.Do(req)
 	if err != nil {
+		CountAPIError("deals", 0)
 		log.Println("Error making HTTP request:", err)
 		return nil
 	}
@@ -113,6 +120,7 @@ func GetDealsData() *DealDetails {
 	//Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		CountAPIError("deals", 0)
 		log.Println("Error reading response body:", err)
 		return nil
 	}
@@ -121,6 +129,7 @@ func GetDealsData() *DealDetails {
 	var dealDetails DealDetails
 	err = json.Unmarshal(body, &dealDetails)
 	if err != nil {
+		CountAPIError("deals", resp.StatusCode)
 		log.Println("Error unmarshalling JSON:", err)
 		return nil
 	}
@@ -153,22 +162,37 @@ type collectibleResponse struct {
 	ProductId         int64
 }
 
-// Retrieves collectible and product id of limited from its asset id
+// Retrieves collectible id of limited from its asset id (cached across runs)
 func GetCollectibleId(assetId string) (string, error) {
+	ids, err := collectibles.Resolve(assetId)
+	return ids.CollectibleItemID, err
+}
+
+// Retrieves collectible and product id of limited from the catalog API
+func FetchCollectibleIDs(assetId string) (CollectibleIDs, error) {
+	var ids CollectibleIDs
 	url := fmt.Sprintf(config.AssetAPI, assetId)
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return "", err
+		return ids, err
 	}
 	FastHeaders(req)
-	req.Header.Set("Cookie", fmt.Sprintf(".ROBLOSECURITY=%s;", config.RobloxCookie))
+	SetSessionCookie(req)
 
 	client := GlobalClient
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		CountAPIError("asset", 0)
+		return ids, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		CountAPIError("asset", resp.StatusCode)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ids, ErrSessionExpired
+	}
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
@@ -176,19 +200,19 @@ func GetCollectibleId(assetId string) (string, error) {
 		if len(snippet) > 200 {
 			snippet = snippet[:200] + "..."
 		}
-		return "", fmt.Errorf("asset API returned %d: %s", resp.StatusCode, snippet)
+		return ids, fmt.Errorf("asset API returned %d: %s", resp.StatusCode, snippet)
 	}
 
 	//Retrieve collectibleId from catalog endpoint
 	var res collectibleResponse
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return "", err
+		return ids, err
 	}
 
 	if res.CollectibleItemId == "" {
-		return "", err
+		return ids, fmt.Errorf("asset %s is not a collectible", assetId)
 	}
-	return res.CollectibleItemId, nil
+	return CollectibleIDs{CollectibleItemID: res.CollectibleItemId, ProductID: res.ProductId}, nil
 }
 
 // Gets all resellers of an item
@@ -199,11 +223,12 @@ func GetResellers(collectibleId string) ([]ResellerResponse, error) {
 		return nil, err
 	}
 	FastHeaders(req)
-	req.Header.Set("Cookie", fmt.Sprintf(".ROBLOSECURITY=%s;", config.RobloxCookie))
+	SetSessionCookie(req)
 
 	client := GlobalClient
 	resp, err := client.Do(req)
 	if err != nil {
+		CountAPIError("resellers", 0)
 		return nil, err
 	}
 	defer resp.Body.Close()
@@ -211,8 +236,15 @@ func GetResellers(collectibleId string) ([]ResellerResponse, error) {
 	//Read reseller listings and handle errors
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		CountAPIError("resellers", 0)
 		return nil, fmt.Errorf("error reading body: %w", err)
 	}
+	if resp.StatusCode != http.StatusOK {
+		CountAPIError("resellers", resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrSessionExpired
+	}
 	if resp.StatusCode != http.StatusOK {
 		snippet := string(body)
 		if len(snippet) > 200 {
@@ -257,36 +289,63 @@ type LimitedItem struct {
 
 // Get all limited item ids in player inventory
 func GetInventory(playerId string) ([]string) {
+	idList, err := FetchInventory(playerId)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return idList
+}
+
+// Get all limited item ids in player inventory (one per copy), telling errors apart from an empty inventory
+func FetchInventory(playerId string) ([]string, error) {
+	assets, err := FetchInventoryUAIDs(playerId)
+	if err != nil {
+		return nil, err
+	}
+	idList := []string{}
+	for item, uaidList := range assets {
+		for i := 0; i < len(uaidList); i++ {
+			idList = append(idList, item) //includes duplicates
+		} 
+	}
+	return idList, nil
+}
+
+// Get the UAIDs (user asset ids) of every limited copy in player inventory, by item id
+func FetchInventoryUAIDs(playerId string) (map[string][]int64, error) {
 	//Roblox API endpoint for player inventory
 	apiURL := fmt.Sprintf(config.InventoryAPI, playerId)
 
 	//GET request to the Rolimons API
 	resp, err := http.Get(apiURL)
 	if err != nil {
-		log.Printf("Error making HTTP request: %v", err)
-		return nil
+		CountAPIError("inventory", 0)
+		return nil, fmt.Errorf("error making HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	//Read response body
 	var data PlayerData
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		log.Printf("Error decoding JSON: %v", err)
-		return nil
+		CountAPIError("inventory", resp.StatusCode)
+		return nil, fmt.Errorf("error decoding JSON: %w", err)
 	}
-
-	var idList []string
-	for item, uaidList := range data.PlayerAssets {
-		for i := 0; i < len(uaidList); i++ {
-			idList = append(idList, item) //includes duplicates
-		} 
+	if !data.Success {
+		return nil, fmt.Errorf("inventory of %s not available", playerId)
 	}
-	return idList
+	return data.PlayerAssets, nil
 }
 
-func init() {
+// Applies runtime settings and loads user agents and proxies
+func Configure(s *config.Settings) {
+	settings = s
+
+	//Load resolved collectible ids
+	collectibles = LoadCollectibleCache(settings.CollectibleCacheFile)
+
 	//Initialize user agents
-	headerFile, err := os.Open(config.AgentsFile)
+	headerFile, err := os.Open(settings.AgentsFile)
 	if err != nil {
 		log.Println("Unable to open agent file: ", err)
 	}
@@ -299,7 +358,10 @@ func init() {
 
 
 	//Initialize proxy URLs
-	proxyFile, err := os.Open(config.ProxyFile)
+	if !settings.RotateProxies {
+		return
+	}
+	proxyFile, err := os.Open(settings.ProxyFile)
 	if err != nil {
 		log.Println("Unable to open proxy file: ", err)
 	}
@@ -0,0 +1,199 @@
+package tools
+
+/*
+Resamples irregular time-series sales data onto a fixed 1-day grid.
+Reports every stretch of missing days so callers know which points were synthesized.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Seconds in one resampled step
+const DayUnit = int64(24 * 60 * 60)
+
+// How missing or duplicate days are filled in
+type ResampleMethod int
+
+const (
+	ResampleLinear      ResampleMethod = iota //Interpolate linearly in time between neighboring sales
+	ResampleForwardFill                       //Carry the last observed price forward
+	ResampleVolume                            //Volume-weighted mean of sales within each day, linear across empty days
+)
+
+// Stretch of days with no observed sales between two observations
+type Gap struct {
+	From int64 //Timestamp of last observation before the gap
+	To   int64 //Timestamp of first observation after the gap
+	Days int   //Number of grid days synthesized inside the gap
+}
+
+// Daily price series on a fixed grid, oldest first
+type ResampledSeries struct {
+	Timestamp []int64
+	Price     []float64
+	Gaps      []Gap
+}
+
+type salesSample struct {
+	t      int64
+	price  float64
+	volume float64
+}
+
+/*
+Resamples sales onto 1-day steps within [from, to] (unix seconds).
+
+The grid is anchored at the latest observation inside the window and steps back one
+day at a time, so the most recent sale always lands on a grid point. Observations
+outside the window are still used as interpolation anchors for the edge days.
+*/
+func Resample(sales *Sales, from int64, to int64, method ResampleMethod) (*ResampledSeries, error) {
+	if sales == nil {
+		return nil, errors.New("resample: no sales data")
+	}
+	if len(sales.Timestamp) != len(sales.AvgDailySalesPrice) {
+		return nil, fmt.Errorf("resample: %d timestamps but %d prices", len(sales.Timestamp), len(sales.AvgDailySalesPrice))
+	}
+	if from > to {
+		return nil, fmt.Errorf("resample: window start %d after end %d", from, to)
+	}
+
+	//Copy into samples sorted by time (volume defaults to 1 when missing)
+	samples := make([]salesSample, len(sales.Timestamp))
+	for i := range sales.Timestamp {
+		volume := 1.0
+		if i < len(sales.SalesVolume) && sales.SalesVolume[i] > 0 {
+			volume = float64(sales.SalesVolume[i])
+		}
+		samples[i] = salesSample{t: sales.Timestamp[i], price: float64(sales.AvgDailySalesPrice[i]), volume: volume}
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].t < samples[j].t
+	})
+
+	//Anchor grid at last observation within window
+	anchor := int64(math.MinInt64)
+	for _, s := range samples {
+		if from <= s.t && s.t <= to {
+			anchor = s.t
+		}
+	}
+	if anchor == math.MinInt64 {
+		return nil, fmt.Errorf("resample: no sales between %d and %d", from, to)
+	}
+	start := max(from, samples[0].t)
+
+	var grid []int64
+	for g := anchor; g >= start; g -= DayUnit {
+		grid = append(grid, g)
+	}
+	for i, j := 0, len(grid)-1; i < j; i, j = i+1, j-1 {
+		grid[i], grid[j] = grid[j], grid[i]
+	}
+
+	series := &ResampledSeries{
+		Timestamp: grid,
+		Price:     make([]float64, len(grid)),
+	}
+
+	//Walk grid and samples together (k = index of last sample at or before g)
+	k := 0
+	for i, g := range grid {
+		for k+1 < len(samples) && samples[k+1].t <= g {
+			k++
+		}
+		prev := samples[k]
+		switch method {
+		case ResampleForwardFill:
+			series.Price[i] = prev.price
+		case ResampleVolume:
+			if p, ok := volumeWeighted(samples, g-DayUnit, g); ok {
+				series.Price[i] = p
+			} else {
+				series.Price[i] = interpolate(samples, k, g)
+			}
+		default:
+			series.Price[i] = interpolate(samples, k, g)
+		}
+	}
+
+	series.Gaps = findGaps(samples, grid)
+	return series, nil
+}
+
+// Linear interpolation at time g between samples[k] and samples[k+1]
+func interpolate(samples []salesSample, k int, g int64) float64 {
+	prev := samples[k]
+	if prev.t == g || k+1 >= len(samples) {
+		return prev.price
+	}
+	next := samples[k+1]
+	frac := float64(g-prev.t) / float64(next.t-prev.t)
+	return prev.price + (next.price-prev.price)*frac
+}
+
+// Volume-weighted mean price of samples in (lo, hi]
+func volumeWeighted(samples []salesSample, lo int64, hi int64) (float64, bool) {
+	var sum, weight float64
+	for _, s := range samples {
+		if lo < s.t && s.t <= hi {
+			sum += s.price * s.volume
+			weight += s.volume
+		}
+	}
+	if weight == 0 {
+		return 0, false
+	}
+	return sum / weight, true
+}
+
+// Finds runs of grid days with no observation between consecutive samples
+func findGaps(samples []salesSample, grid []int64) []Gap {
+	var gaps []Gap
+	if len(grid) == 0 {
+		return gaps
+	}
+	first, last := grid[0], grid[len(grid)-1]
+	for i := 1; i < len(samples); i++ {
+		a, b := samples[i-1].t, samples[i].t
+		if b-a <= DayUnit || b < first || a > last {
+			continue
+		}
+		//Count synthesized grid days strictly inside (a, b)
+		days := 0
+		for _, g := range grid {
+			if a < g && g < b {
+				days++
+			}
+		}
+		if days > 0 {
+			gaps = append(gaps, Gap{From: a, To: b, Days: days})
+		}
+	}
+	return gaps
+}
+
+// Mean and sample standard deviation of a series
+func MeanStdDev(points []float64) (float64, float64) {
+	n := float64(len(points))
+	if n == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, p := range points {
+		mean += p
+	}
+	mean /= n
+	if n < 2 {
+		return mean, 0
+	}
+	std := 0.0
+	for _, p := range points {
+		std += (p - mean) * (p - mean)
+	}
+	return mean, math.Sqrt(std / (n - 1))
+}
@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+const day = DayUnit
+
+func TestResample(t *testing.T) {
+	tests := []struct {
+		name     string
+		sales    *Sales
+		from, to int64
+		method   ResampleMethod
+		wantTime []int64
+		want     []float64
+		wantGaps []Gap
+		wantErr  bool
+	}{
+		{
+			name:     "linear fills a missing day",
+			sales:    &Sales{Timestamp: []int64{0, 2 * day}, AvgDailySalesPrice: []int{100, 300}},
+			from:     0,
+			to:       2 * day,
+			method:   ResampleLinear,
+			wantTime: []int64{0, day, 2 * day},
+			want:     []float64{100, 200, 300},
+			wantGaps: []Gap{{From: 0, To: 2 * day, Days: 1}},
+		},
+		{
+			name:     "linear interpolates off-grid sales",
+			sales:    &Sales{Timestamp: []int64{0, day / 2, 2 * day}, AvgDailySalesPrice: []int{100, 150, 450}},
+			from:     0,
+			to:       2 * day,
+			method:   ResampleLinear,
+			wantTime: []int64{0, day, 2 * day},
+			want:     []float64{100, 250, 450},
+			wantGaps: []Gap{{From: day / 2, To: 2 * day, Days: 1}},
+		},
+		{
+			name:     "ffill carries the last price",
+			sales:    &Sales{Timestamp: []int64{0, 2 * day}, AvgDailySalesPrice: []int{100, 300}},
+			from:     0,
+			to:       2 * day,
+			method:   ResampleForwardFill,
+			wantTime: []int64{0, day, 2 * day},
+			want:     []float64{100, 100, 300},
+			wantGaps: []Gap{{From: 0, To: 2 * day, Days: 1}},
+		},
+		{
+			name:     "volume weights sales within a day",
+			sales:    &Sales{Timestamp: []int64{0, day - 100, day}, AvgDailySalesPrice: []int{100, 200, 400}, SalesVolume: []int{1, 1, 3}},
+			from:     0,
+			to:       day,
+			method:   ResampleVolume,
+			wantTime: []int64{0, day},
+			want:     []float64{100, 350},
+		},
+		{
+			name:     "volume is linear across empty days",
+			sales:    &Sales{Timestamp: []int64{0, 3 * day}, AvgDailySalesPrice: []int{100, 400}, SalesVolume: []int{2, 5}},
+			from:     0,
+			to:       3 * day,
+			method:   ResampleVolume,
+			wantTime: []int64{0, day, 2 * day, 3 * day},
+			want:     []float64{100, 200, 300, 400},
+			wantGaps: []Gap{{From: 0, To: 3 * day, Days: 2}},
+		},
+		{
+			name:     "unsorted input",
+			sales:    &Sales{Timestamp: []int64{day, 0}, AvgDailySalesPrice: []int{200, 100}},
+			from:     0,
+			to:       day,
+			method:   ResampleLinear,
+			wantTime: []int64{0, day},
+			want:     []float64{100, 200},
+		},
+		{
+			name:     "single point",
+			sales:    &Sales{Timestamp: []int64{5 * day}, AvgDailySalesPrice: []int{250}},
+			from:     0,
+			to:       5 * day,
+			method:   ResampleLinear,
+			wantTime: []int64{5 * day},
+			want:     []float64{250},
+		},
+		{
+			name:    "empty input",
+			sales:   &Sales{},
+			from:    0,
+			to:      day,
+			wantErr: true,
+		},
+		{
+			name:    "nil input",
+			from:    0,
+			to:      day,
+			wantErr: true,
+		},
+		{
+			name:    "no sales in window",
+			sales:   &Sales{Timestamp: []int64{10 * day}, AvgDailySalesPrice: []int{100}},
+			from:    0,
+			to:      day,
+			wantErr: true,
+		},
+		{
+			name:    "mismatched lengths",
+			sales:   &Sales{Timestamp: []int64{0, day}, AvgDailySalesPrice: []int{100}},
+			from:    0,
+			to:      day,
+			wantErr: true,
+		},
+		{
+			name:    "window reversed",
+			sales:   &Sales{Timestamp: []int64{0}, AvgDailySalesPrice: []int{100}},
+			from:    day,
+			to:      0,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series, err := Resample(tt.sales, tt.from, tt.to, tt.method)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %+v", series)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(series.Timestamp, tt.wantTime) {
+				t.Errorf("timestamps = %v, want %v", series.Timestamp, tt.wantTime)
+			}
+			if !approxEqual(series.Price, tt.want) {
+				t.Errorf("prices = %v, want %v", series.Price, tt.want)
+			}
+			if !reflect.DeepEqual(series.Gaps, tt.wantGaps) {
+				t.Errorf("gaps = %+v, want %+v", series.Gaps, tt.wantGaps)
+			}
+		})
+	}
+}
+
+func TestResampleLongGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		sales    *Sales
+		wantGaps []Gap
+		wantMean float64
+		wantStd  float64
+	}{
+		{
+			name:     "one gap of three days",
+			sales:    &Sales{Timestamp: []int64{0, 4 * day}, AvgDailySalesPrice: []int{100, 500}},
+			wantGaps: []Gap{{From: 0, To: 4 * day, Days: 3}},
+			wantMean: 300,
+			wantStd:  math.Sqrt(25000),
+		},
+		{
+			name:     "two gaps around a sale",
+			sales:    &Sales{Timestamp: []int64{0, 3 * day, 6 * day}, AvgDailySalesPrice: []int{100, 100, 400}},
+			wantGaps: []Gap{{From: 0, To: 3 * day, Days: 2}, {From: 3 * day, To: 6 * day, Days: 2}},
+			wantMean: (100*4 + 200 + 300 + 400) / 7.0,
+			wantStd:  math.Sqrt((4*math.Pow(100-1300/7.0, 2) + math.Pow(200-1300/7.0, 2) + math.Pow(300-1300/7.0, 2) + math.Pow(400-1300/7.0, 2)) / 6),
+		},
+		{
+			name:     "daily sales have no gaps",
+			sales:    &Sales{Timestamp: []int64{0, day, 2 * day}, AvgDailySalesPrice: []int{100, 200, 300}},
+			wantMean: 200,
+			wantStd:  100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last := tt.sales.Timestamp[len(tt.sales.Timestamp)-1]
+			series, err := Resample(tt.sales, 0, last, ResampleLinear)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(series.Gaps, tt.wantGaps) {
+				t.Errorf("gaps = %+v, want %+v", series.Gaps, tt.wantGaps)
+			}
+			mean, std := MeanStdDev(series.Price)
+			if math.Abs(mean-tt.wantMean) > 1e-9 || math.Abs(std-tt.wantStd) > 1e-9 {
+				t.Errorf("mean, std = %v, %v, want %v, %v", mean, std, tt.wantMean, tt.wantStd)
+			}
+		})
+	}
+}
+
+func TestMeanStdDev(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    []float64
+		mean, std float64
+	}{
+		{name: "empty"},
+		{name: "single", points: []float64{7}, mean: 7},
+		{name: "sample deviation", points: []float64{2, 4, 4, 4, 5, 5, 7, 9}, mean: 5, std: math.Sqrt(32.0 / 7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, std := MeanStdDev(tt.points)
+			if math.Abs(mean-tt.mean) > 1e-9 || math.Abs(std-tt.std) > 1e-9 {
+				t.Errorf("MeanStdDev(%v) = %v, %v, want %v, %v", tt.points, mean, std, tt.mean, tt.std)
+			}
+		})
+	}
+}
+
+func approxEqual(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
@@ -8,7 +8,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"robolimited/config"
 	"strconv"
 	"time"
 	"log"
@@ -46,7 +45,7 @@ var SalesData = make(map[string]*Sales)
 
 //Store sales statistics data to a CSV file
 func StoreSalesStats(data []StatsPoint) {
-	file, err := os.Create(config.SalesStatsFile)
+	file, err := os.Create(settings.SalesStatsFile)
 	if err != nil {
 		fmt.Printf("Failed to create CSV file")
 		return
@@ -79,7 +78,7 @@ func StoreSalesStats(data []StatsPoint) {
 
 //Retrieves statistics data of specific ID from CSV file
 func RetrieveSalesStats() map[string]Stats {
-	file, err := os.Open(config.SalesStatsFile)
+	file, err := os.Open(settings.SalesStatsFile)
 	if err != nil {
 		log.Println("Failed to open CSV file", err)
 		return nil
@@ -133,7 +132,7 @@ func StoreSalesData(data map[string]*Sales) {
 		log.Println("Error marshalling sales data:", err)
 		return
 	}
-	err = os.WriteFile(config.SalesDataFile, jsonData, 0644)
+	err = os.WriteFile(settings.SalesDataFile, jsonData, 0644)
 	if (err != nil) {
 		log.Println("Error writing sales data to file:", err)
 		return
@@ -142,7 +141,7 @@ func StoreSalesData(data map[string]*Sales) {
 }
 //Retrieves raw sales data of specific ID from JSON file
 func RetrieveSalesData() (map[string] *Sales) {
-	bytes, err := os.ReadFile(config.SalesDataFile)
+	bytes, err := os.ReadFile(settings.SalesDataFile)
 	var data map[string]*Sales
 	if (err != nil) {
 		log.Println("Error reading from json file:", err)
@@ -0,0 +1,222 @@
+package tools
+
+/*
+Models the premium that special serial numbers (#1, low serials, repeating digits)
+command over regular copies, fitted from observed reseller listings.
+Sales data carries no serials, so listing asks are the only observations available.
+Premiums only rank listings that already pass the price check, since they are fitted
+from the same asks being judged. The model is safe for concurrent use.
+*/
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Serial classes that trade at distinct premiums
+type SerialClass string
+
+const (
+	SerialFirst   SerialClass = "first"   //#1
+	SerialSpecial SerialClass = "special" //Repeating digits (#77, #333, #5555)
+	SerialLow10   SerialClass = "low10"   //#2-10
+	SerialLow100  SerialClass = "low100"  //#11-100
+	SerialRegular SerialClass = "regular" //Everything else (and unknown serials)
+)
+
+const maxSerialObservations = 500 //Ratios kept per class
+const minSerialObservations = 5   //Ratios needed before a class premium is trusted
+
+// Fitted premium multipliers per serial class
+type SerialModel struct {
+	Ratios   map[SerialClass][]float64 `json:"ratios"`   //Observed price / regular baseline
+	Premiums map[SerialClass]float64   `json:"premiums"` //Fitted median ratio
+
+	mu    sync.Mutex
+	dirty bool //Observed since the last refit
+}
+
+// Classifies a serial number into its premium class
+func ClassifySerial(serial int64) SerialClass {
+	switch {
+	case serial <= 0:
+		return SerialRegular
+	case serial == 1:
+		return SerialFirst
+	}
+
+	digits := strconv.FormatInt(serial, 10)
+	repeating := len(digits) > 1
+	for i := 1; i < len(digits); i++ {
+		if digits[i] != digits[0] {
+			repeating = false
+			break
+		}
+	}
+
+	switch {
+	case repeating:
+		return SerialSpecial
+	case serial <= 10:
+		return SerialLow10
+	case serial <= 100:
+		return SerialLow100
+	}
+	return SerialRegular
+}
+
+// Constructor
+func NewSerialModel() *SerialModel {
+	return &SerialModel{
+		Ratios:   make(map[SerialClass][]float64),
+		Premiums: make(map[SerialClass]float64),
+	}
+}
+
+// Records premium ratios of an item's listings against its regular-serial median
+func (m *SerialModel) Observe(listings []ResellerResponse) {
+	var regular []float64
+	for _, l := range listings {
+		if ClassifySerial(l.SerialNumber) == SerialRegular && l.Price > 0 {
+			regular = append(regular, float64(l.Price))
+		}
+	}
+	if len(regular) == 0 {
+		return //No baseline to compare against
+	}
+	baseline := median(regular)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, l := range listings {
+		class := ClassifySerial(l.SerialNumber)
+		if class == SerialRegular || l.Price <= 0 {
+			continue
+		}
+		ratios := append(m.Ratios[class], float64(l.Price)/baseline)
+		if len(ratios) > maxSerialObservations {
+			ratios = ratios[len(ratios)-maxSerialObservations:]
+		}
+		m.Ratios[class] = ratios
+		m.dirty = true
+	}
+}
+
+// Refits class premiums as the median observed ratio (never below 1)
+func (m *SerialModel) Fit() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fit()
+}
+
+func (m *SerialModel) fit() {
+	m.dirty = false
+	for class, ratios := range m.Ratios {
+		if len(ratios) < minSerialObservations {
+			delete(m.Premiums, class)
+			continue
+		}
+		m.Premiums[class] = max(1.0, median(ratios))
+	}
+}
+
+// Premium multiplier of a serial (1 when unfitted)
+func (m *SerialModel) Premium(serial int64) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.premium(serial)
+}
+
+func (m *SerialModel) premium(serial int64) float64 {
+	if p, ok := m.Premiums[ClassifySerial(serial)]; ok {
+		return p
+	}
+	return 1.0
+}
+
+// Picks the listing with the lowest serial-adjusted price among the cheapest depth listings
+// costing at most maxPrice, false if none does
+func (m *SerialModel) SelectListing(book *OrderBook, depth int, maxPrice int) (ResellerResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var best ResellerResponse
+	bestAdjusted, found := 0.0, false
+	for i := 0; i < min(depth, book.Count()); i++ {
+		l := book.Listings[i]
+		if l.Price > maxPrice {
+			break //Sorted by price
+		}
+		adjusted := float64(l.Price) / m.premium(l.SerialNumber)
+		if !found || adjusted < bestAdjusted {
+			best, bestAdjusted, found = l, adjusted, true
+		}
+	}
+	return best, found
+}
+
+// Loads serial model from JSON file (empty model if none stored yet)
+func LoadSerialModel(fileName string) *SerialModel {
+	m := NewSerialModel()
+	bytes, err := os.ReadFile(fileName)
+	if err != nil {
+		return m
+	}
+	if err := json.Unmarshal(bytes, m); err != nil {
+		log.Println("Error unmarshaling serial model from json:", err)
+		return NewSerialModel()
+	}
+	if m.Ratios == nil {
+		m.Ratios = make(map[SerialClass][]float64)
+	}
+	if m.Premiums == nil {
+		m.Premiums = make(map[SerialClass]float64)
+	}
+	return m
+}
+
+// Stores serial model to JSON file
+func (m *SerialModel) Store(fileName string) {
+	m.mu.Lock()
+	jsonData, err := json.Marshal(m)
+	m.mu.Unlock()
+	m.write(fileName, jsonData, err)
+}
+
+// Refits and stores the model if listings were observed since the last fit
+func (m *SerialModel) Refit(fileName string) bool {
+	m.mu.Lock()
+	if !m.dirty {
+		m.mu.Unlock()
+		return false
+	}
+	m.fit()
+	jsonData, err := json.Marshal(m)
+	m.mu.Unlock()
+	m.write(fileName, jsonData, err)
+	return true
+}
+
+func (m *SerialModel) write(fileName string, jsonData []byte, err error) {
+	if err != nil {
+		log.Println("Error marshalling serial model:", err)
+		return
+	}
+	if err := writeFileAtomic(fileName, jsonData, 0644); err != nil {
+		log.Println("Error writing serial model to file:", err)
+	}
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
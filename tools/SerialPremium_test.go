@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifySerial(t *testing.T) {
+	tests := map[int64]SerialClass{
+		0:     SerialRegular,
+		1:     SerialFirst,
+		7:     SerialLow10,
+		77:    SerialSpecial,
+		42:    SerialLow100,
+		5555:  SerialSpecial,
+		101:   SerialRegular,
+		12345: SerialRegular,
+	}
+	for serial, want := range tests {
+		if got := ClassifySerial(serial); got != want {
+			t.Errorf("ClassifySerial(%d) = %s, want %s", serial, got, want)
+		}
+	}
+}
+
+func TestSelectListing(t *testing.T) {
+	m := NewSerialModel()
+	m.Premiums[SerialFirst] = 3
+	book := BuildOrderBook([]ResellerResponse{
+		{Price: 120, SerialNumber: 1},
+		{Price: 100, SerialNumber: 500},
+		{Price: 105, SerialNumber: 600},
+	})
+	tests := []struct {
+		name       string
+		depth      int
+		maxPrice   int
+		wantSerial int64
+		wantOK     bool
+	}{
+		{name: "premium ranks within price", depth: 3, maxPrice: 150, wantSerial: 1, wantOK: true},
+		{name: "premium listing above price", depth: 3, maxPrice: 110, wantSerial: 500, wantOK: true},
+		{name: "depth one is cheapest", depth: 1, maxPrice: 150, wantSerial: 500, wantOK: true},
+		{name: "nothing within price", depth: 3, maxPrice: 99, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.SelectListing(book, tt.depth, tt.maxPrice)
+			if ok != tt.wantOK || got.SerialNumber != tt.wantSerial {
+				t.Errorf("SelectListing = #%d, %v, want #%d, %v", got.SerialNumber, ok, tt.wantSerial, tt.wantOK)
+			}
+			if ok && got.Price > tt.maxPrice {
+				t.Errorf("picked a listing for %d above %d", got.Price, tt.maxPrice)
+			}
+		})
+	}
+}
+
+func TestRefit(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "serial_model.json")
+	m := NewSerialModel()
+	if m.Refit(fileName) {
+		t.Fatal("refit with nothing observed")
+	}
+
+	listings := []ResellerResponse{{Price: 100, SerialNumber: 500}, {Price: 300, SerialNumber: 1}}
+	for range minSerialObservations {
+		m.Observe(listings)
+	}
+	if !m.Refit(fileName) {
+		t.Fatal("no refit after observing")
+	}
+	if m.Refit(fileName) {
+		t.Error("refit again with nothing new observed")
+	}
+	if got := LoadSerialModel(fileName).Premium(1); got != 3 {
+		t.Errorf("stored premium of #1 = %v, want 3", got)
+	}
+}
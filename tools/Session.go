@@ -0,0 +1,74 @@
+package tools
+
+/*
+Attaches the Roblox session cookie to requests and checks that the session is still valid.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"robolimited/config"
+)
+
+var ErrNoSession = errors.New("no Roblox session configured: set " + config.CookieEnv + " or cookie_file")
+var ErrSessionExpired = errors.New("Roblox session expired or invalid: replace the .ROBLOSECURITY cookie")
+
+// Account the session cookie belongs to
+type AccountInfo struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// Attaches the session cookie to a request
+func SetSessionCookie(req *http.Request) {
+	req.Header.Set("Cookie", ".ROBLOSECURITY="+settings.Cookie.Reveal()+";")
+}
+
+// Checks the session against the authenticated-user endpoint
+func ValidateSession() (*AccountInfo, error) {
+	if !settings.Cookie.IsSet() {
+		return nil, ErrNoSession
+	}
+
+	req, err := http.NewRequest(http.MethodGet, config.AuthenticatedUserAPI, nil)
+	if err != nil {
+		return nil, err
+	}
+	FastHeaders(req)
+	SetSessionCookie(req)
+
+	resp, err := GlobalClient.Do(req)
+	if err != nil {
+		CountAPIError("session", 0)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		CountAPIError("session", resp.StatusCode)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrSessionExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		snippet := string(body)
+		if len(snippet) > 200 {
+			snippet = snippet[:200] + "..."
+		}
+		return nil, fmt.Errorf("account API returned %d: %s", resp.StatusCode, snippet)
+	}
+
+	var account AccountInfo
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return nil, err
+	}
+	if settings.RobloxId != 0 && account.Id != settings.RobloxId {
+		return &account, fmt.Errorf("session belongs to user %d (%s), but roblox_id is %d", account.Id, account.Name, settings.RobloxId)
+	}
+	return &account, nil
+}
@@ -0,0 +1,179 @@
+package tools
+
+/*
+Shadow execution of paper buys: right after a simulated decision the live reseller
+listings are fetched to see whether a listing at the deal price was still up. Checks
+are appended to a JSON lines file and summarized per strategy, so paper results can
+be discounted by how often a real buy would have filled.
+*/
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Result of checking one paper buy against the live listings
+type ShadowFill struct {
+	Time         time.Time `json:"time"`
+	Strategy     string    `json:"strategy"`
+	AssetID      string    `json:"asset_id"`
+	Price        int       `json:"price"`      //Deal price the strategy decided on
+	Filled       bool      `json:"filled"`     //A listing at or below the deal price was still up
+	BestPrice    int       `json:"best_price"` //Lowest listing at check time (0 if none)
+	Serial       int64     `json:"serial,omitempty"`
+	CheckLatency float64   `json:"check_latency"` //Seconds from the deal activity to the check, not how long the listing stayed up
+	Error        string    `json:"error,omitempty"`
+}
+
+// Fills a check from reseller listings; the cheapest listing at or below the deal price fills it
+func (f *ShadowFill) Match(listings []ResellerResponse) {
+	f.Filled, f.BestPrice, f.Serial = false, 0, 0
+	for _, l := range listings {
+		if l.Price <= 0 || (f.BestPrice != 0 && l.Price >= f.BestPrice) {
+			continue
+		}
+		f.BestPrice, f.Serial = l.Price, l.SerialNumber
+	}
+	f.Filled = f.BestPrice != 0 && f.BestPrice <= f.Price
+	if !f.Filled {
+		f.Serial = 0
+	}
+}
+
+// Outcome label of a check
+func (f ShadowFill) Result() string {
+	switch {
+	case f.Error != "":
+		return "error"
+	case f.Filled:
+		return "filled"
+	default:
+		return "missed"
+	}
+}
+
+// Fill counts of one strategy
+type ShadowStats struct {
+	Strategy     string
+	Filled       int
+	Missed       int
+	Errors       int
+	Saved        int     //Robux saved on fills (deal price minus fill price)
+	CheckLatency float64 //Summed seconds from activity to check
+}
+
+// Share of checked buys that filled (NaN if none checked)
+func (s ShadowStats) FillRate() float64 {
+	return float64(s.Filled) / float64(s.Filled+s.Missed)
+}
+
+func (s ShadowStats) String() string {
+	checked := s.Filled + s.Missed
+	line := "Shadow " + s.Strategy + " | Filled: " + strconv.Itoa(s.Filled) + " / " + strconv.Itoa(checked)
+	if checked > 0 {
+		line += " (" + strconv.FormatFloat(s.FillRate()*100, 'f', 1, 64) + "%)" +
+			" | Avg. check latency: " + strconv.FormatFloat(s.CheckLatency/float64(checked), 'f', 1, 64) + "s"
+	}
+	if s.Filled > 0 {
+		line += " | Saved on fills: " + strconv.Itoa(s.Saved)
+	}
+	if s.Errors > 0 {
+		line += " | Errors: " + strconv.Itoa(s.Errors)
+	}
+	return line
+}
+
+// Collects shadow checks in memory and in a JSON lines file
+type ShadowRecorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	stats map[string]*ShadowStats
+}
+
+// Opens fileName for appending checks (counts only if empty or unwritable)
+func NewShadowRecorder(fileName string) *ShadowRecorder {
+	r := &ShadowRecorder{stats: make(map[string]*ShadowStats)}
+	if fileName == "" {
+		return r
+	}
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("Could not open shadow file, keeping counts in memory:", err)
+		return r
+	}
+	r.file = file
+	return r
+}
+
+// Adds a check to the counts and the file
+func (r *ShadowRecorder) Record(f ShadowFill) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.stats[f.Strategy]
+	if !ok {
+		s = &ShadowStats{Strategy: f.Strategy}
+		r.stats[f.Strategy] = s
+	}
+	switch f.Result() {
+	case "error":
+		s.Errors++
+	case "filled":
+		s.Filled++
+		s.Saved += f.Price - f.BestPrice
+		s.CheckLatency += f.CheckLatency
+	default:
+		s.Missed++
+		s.CheckLatency += f.CheckLatency
+	}
+
+	if r.file == nil {
+		return
+	}
+	line, err := json.Marshal(f)
+	if err != nil {
+		log.Println("Error marshalling shadow fill:", err)
+		return
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		log.Println("Error writing shadow fill to file:", err)
+	}
+}
+
+// Counts per strategy, by name
+func (r *ShadowRecorder) Stats() []ShadowStats {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make([]ShadowStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Strategy < stats[j].Strategy
+	})
+	return stats
+}
+
+// Closes the shadow file
+func (r *ShadowRecorder) Close() {
+	if r == nil || r.file == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.file.Close(); err != nil {
+		log.Println("Error closing shadow file:", err)
+	}
+	r.file = nil
+}
@@ -6,14 +6,24 @@ Enables testing without using live money
 */
 
 import (
-	"robolimited/config"
+	"log"
 	"strconv"
+	"time"
 )
 
+// A single held copy of an item
+type Lot struct {
+	Price  int
+	Serial int64     //0 if unknown
+	Time   time.Time //When the lot was bought
+}
+
 type TradeSimulator struct {
+	Name        string //Label on action log lines (e.g. strategy name)
 	RobuxSpent  int
 	RobuxGained int
-	Portfolio   map[string][]int
+	Portfolio   map[string][]Lot
+	Registry    *PurchaseRegistry //Optional duplicate-purchase guard
 }
 
 // Constructor
@@ -21,43 +31,61 @@ func NewTradeSimulator() *TradeSimulator {
 	return &TradeSimulator{
 		RobuxSpent:  0,
 		RobuxGained: 0,
-		Portfolio:   make(map[string][]int),
+		Portfolio:   make(map[string][]Lot),
 	}
 }
 
-// Buy an item
-func (ts *TradeSimulator) BuyItem(id string, name string, price int) {
-	WriteLineToFile(config.ActionLogFile, "Bought "+name+" for "+strconv.Itoa(price))
-	ts.Portfolio[id] = append(ts.Portfolio[id], price)
-	ts.RobuxSpent += price
-}
+// Buy an item; false if the registry refuses it as a duplicate
+func (ts *TradeSimulator) BuyItem(id string, name string, price int, serial int64) bool {
+	scope := "sim"
+	if ts.Name != "" {
+		scope += ":" + ts.Name
+	}
+	now := time.Now()
+	if err := ts.Registry.Reserve(scope, id, "", now); err != nil {
+		log.Println("Skipped buying", name, "|", err)
+		return false
+	}
+	ts.Registry.Commit(scope, id, "", now)
 
-/* DEPRECATED
-// Sell an item
-func (ts *TradeSimulator) SellItem(id string, name string, price int, value int) {
-	if value != -1 {
-		ts.RobuxGained += int(float64(price) * 0.7)
-		WriteLineToFile(config.ActionLogFile, "Sold "+name+" for "+strconv.Itoa(int(float64(price)*0.7)))
-	} else {
-		ts.RobuxGained += int(float64(value) * 0.7)
-		WriteLineToFile(config.ActionLogFile, "Sold "+name+" for "+strconv.Itoa(int(float64(value)*0.7)))
+	line := "Bought " + name + " for " + strconv.Itoa(price)
+	if ts.Name != "" {
+		line = "[" + ts.Name + "] " + line
+	}
+	if serial > 0 {
+		line += " (#" + strconv.FormatInt(serial, 10) + ")"
 	}
+	WriteLineToFile(settings.ActionLogFile, line)
+	ts.Portfolio[id] = append(ts.Portfolio[id], Lot{Price: price, Serial: serial, Time: now})
+	ts.RobuxSpent += price
+	return true
+}
 
-	newCosts := []int{}
-	deleted := false
-	for _, p := range ts.Portfolio[id] {
-		if p == price && !deleted {
-			deleted = true
+// Sell a held lot at a list price, crediting the proceeds after the marketplace fee; false if not held
+func (ts *TradeSimulator) SellLot(id string, name string, lot Lot, price int) bool {
+	lots := ts.Portfolio[id]
+	for i, held := range lots {
+		if held != lot {
 			continue
 		}
-		newCosts = append(newCosts, p)
-	}
+		ts.Portfolio[id] = append(lots[:i:i], lots[i+1:]...)
+		if len(ts.Portfolio[id]) == 0 {
+			delete(ts.Portfolio, id)
+		}
+		proceeds := NetProceeds(price)
+		ts.RobuxGained += proceeds
 
-	ts.Portfolio[id] = newCosts
+		line := "Sold " + name + " for " + strconv.Itoa(price) + " (net " + strconv.Itoa(proceeds) + ", cost " + strconv.Itoa(lot.Price) + ")"
+		if ts.Name != "" {
+			line = "[" + ts.Name + "] " + line
+		}
+		WriteLineToFile(settings.ActionLogFile, line)
+		return true
+	}
+	return false
 }
-*/
 
 // Get item portfolio
-func (ts *TradeSimulator) GetPortfolio() map[string][]int {
+func (ts *TradeSimulator) GetPortfolio() map[string][]Lot {
 	return ts.Portfolio
 }
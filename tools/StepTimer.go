@@ -0,0 +1,54 @@
+package tools
+
+/*
+Measures how long each step of a multi-step operation takes.
+*/
+
+import (
+	"strings"
+	"time"
+)
+
+// Duration of one named step
+type Step struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+type StepTimer struct {
+	start time.Time
+	last  time.Time
+	Steps []Step
+}
+
+// Starts timing
+func NewStepTimer() *StepTimer {
+	now := time.Now()
+	return &StepTimer{start: now, last: now}
+}
+
+// Starts timing from an earlier moment (e.g. when a deal was listed)
+func NewStepTimerAt(start time.Time) *StepTimer {
+	return &StepTimer{start: start, last: start}
+}
+
+// Ends the current step under name and starts the next
+func (t *StepTimer) Mark(name string) {
+	now := time.Now()
+	t.Steps = append(t.Steps, Step{Name: name, Duration: now.Sub(t.last)})
+	t.last = now
+}
+
+// Time since the timer started
+func (t *StepTimer) Total() time.Duration {
+	return time.Since(t.start)
+}
+
+func (t *StepTimer) String() string {
+	parts := make([]string, 0, len(t.Steps)+1)
+	for _, step := range t.Steps {
+		parts = append(parts, step.Name+" "+step.Duration.Round(time.Microsecond).String())
+	}
+	parts = append(parts, "total "+t.Total().Round(time.Microsecond).String())
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,98 @@
+package tools
+
+/*
+Measures how concentrated an item's supply is among its owners.
+Hoarded items (few holders, many inactive copies) are prone to price manipulation.
+*/
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Ownership concentration and supply metrics of an item
+type SupplyMetrics struct {
+	TotalCopies  int
+	HiddenCopies int //Copies of hidden or deleted owners (owner id 0), left out of the shares below
+	UniqueOwners int
+	Top1Share    float64 //Fraction of visible copies held by largest owner
+	Top10Share   float64 //Fraction of visible copies held by 10 largest owners
+	HHI          float64 //Herfindahl index of owner shares (1/owners = even, 1 = single holder)
+	Inactive30   float64 //Fraction of copies whose owner has been offline 30+ days
+	Inactive90   float64
+	Inactive365  float64
+}
+
+// Computes supply metrics from parallel per-copy owner and last-online arrays (unix seconds)
+func ComputeSupply(ownerIDs []int64, lastOnline []int64, now int64) SupplyMetrics {
+	var m SupplyMetrics
+	m.TotalCopies = len(ownerIDs)
+	if m.TotalCopies == 0 {
+		return m
+	}
+
+	//Count copies per owner; hidden owners all share id 0 and would look like one hoarder
+	held := make(map[int64]int)
+	for _, owner := range ownerIDs {
+		if owner == 0 {
+			m.HiddenCopies++
+			continue
+		}
+		held[owner]++
+	}
+	m.UniqueOwners = len(held)
+
+	counts := make([]int, 0, len(held))
+	for _, c := range held {
+		counts = append(counts, c)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+
+	visible := float64(m.TotalCopies - m.HiddenCopies)
+	for i, c := range counts {
+		share := float64(c) / visible
+		m.HHI += share * share
+		if i < 1 {
+			m.Top1Share += share
+		}
+		if i < 10 {
+			m.Top10Share += share
+		}
+	}
+
+	//Copies held by inactive owners (unknown last online counts as inactive)
+	var inactive30, inactive90, inactive365 int
+	for i := range ownerIDs {
+		var offline int64 = now
+		if i < len(lastOnline) && lastOnline[i] > 0 {
+			offline = now - lastOnline[i]
+		}
+		if offline >= 30*DayUnit {
+			inactive30++
+		}
+		if offline >= 90*DayUnit {
+			inactive90++
+		}
+		if offline >= 365*DayUnit {
+			inactive365++
+		}
+	}
+	total := float64(m.TotalCopies)
+	m.Inactive30 = float64(inactive30) / total
+	m.Inactive90 = float64(inactive90) / total
+	m.Inactive365 = float64(inactive365) / total
+
+	return m
+}
+
+// Checks whether holdings are too concentrated to trust the market price
+func (m SupplyMetrics) IsConcentrated(maxHHI float64, maxTop1Share float64) bool {
+	return m.TotalCopies > 0 && (m.HHI > maxHHI || m.Top1Share > maxTop1Share)
+}
+
+// One-line summary for console output
+func (m SupplyMetrics) String() string {
+	return fmt.Sprintf("Copies: %d (%d hidden) | Owners: %d | Top 1: %.1f%% | Top 10: %.1f%% | HHI: %.3f | Inactive 30/90/365d: %.1f%%/%.1f%%/%.1f%%",
+		m.TotalCopies, m.HiddenCopies, m.UniqueOwners, m.Top1Share*100, m.Top10Share*100, m.HHI,
+		m.Inactive30*100, m.Inactive90*100, m.Inactive365*100)
+}
@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputeSupply(t *testing.T) {
+	const now = 1000 * DayUnit
+	active := now - DayUnit
+	tests := []struct {
+		name       string
+		owners     []int64
+		lastOnline []int64
+		want       SupplyMetrics
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:       "even owners",
+			owners:     []int64{1, 2, 3, 4},
+			lastOnline: []int64{active, active, active, active},
+			want:       SupplyMetrics{TotalCopies: 4, UniqueOwners: 4, Top1Share: 0.25, Top10Share: 1, HHI: 0.25},
+		},
+		{
+			name:       "single hoarder",
+			owners:     []int64{7, 7, 7, 8},
+			lastOnline: []int64{active, active, active, now - 100*DayUnit},
+			want:       SupplyMetrics{TotalCopies: 4, UniqueOwners: 2, Top1Share: 0.75, Top10Share: 1, HHI: 0.625, Inactive30: 0.25, Inactive90: 0.25},
+		},
+		{
+			name:       "hidden owners are not one holder",
+			owners:     []int64{0, 0, 0, 1, 2},
+			lastOnline: []int64{0, 0, 0, active, active},
+			want:       SupplyMetrics{TotalCopies: 5, HiddenCopies: 3, UniqueOwners: 2, Top1Share: 0.5, Top10Share: 1, HHI: 0.5, Inactive30: 0.6, Inactive90: 0.6, Inactive365: 0.6},
+		},
+		{
+			name:       "only hidden owners",
+			owners:     []int64{0, 0},
+			lastOnline: []int64{0, 0},
+			want:       SupplyMetrics{TotalCopies: 2, HiddenCopies: 2, Inactive30: 1, Inactive90: 1, Inactive365: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeSupply(tt.owners, tt.lastOnline, now)
+			if got.TotalCopies != tt.want.TotalCopies || got.HiddenCopies != tt.want.HiddenCopies || got.UniqueOwners != tt.want.UniqueOwners {
+				t.Errorf("counts = %+v, want %+v", got, tt.want)
+			}
+			for _, f := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"Top1Share", got.Top1Share, tt.want.Top1Share},
+				{"Top10Share", got.Top10Share, tt.want.Top10Share},
+				{"HHI", got.HHI, tt.want.HHI},
+				{"Inactive30", got.Inactive30, tt.want.Inactive30},
+				{"Inactive90", got.Inactive90, tt.want.Inactive90},
+				{"Inactive365", got.Inactive365, tt.want.Inactive365},
+			} {
+				if math.Abs(f.got-f.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
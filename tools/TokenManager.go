@@ -0,0 +1,97 @@
+package tools
+
+/*
+Holds the X-CSRF token for authenticated POST requests. Concurrent callers that hit a
+403 share a single refresh instead of each fetching their own token, and callers that
+saw an already replaced token get the new one without another round trip.
+*/
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Result of one token refresh shared by every waiting caller
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+type TokenManager struct {
+	fetch    func() (string, error)
+	mu       sync.Mutex
+	token    string
+	issued   time.Time
+	inFlight *tokenCall
+}
+
+// Constructor; fetch obtains a new token from the API
+func NewTokenManager(fetch func() (string, error)) *TokenManager {
+	return &TokenManager{fetch: fetch}
+}
+
+// Current token (empty before the first refresh)
+func (m *TokenManager) Token() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token
+}
+
+// Time since the current token was fetched (0 if there is none)
+func (m *TokenManager) Age() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token == "" {
+		return 0
+	}
+	return time.Since(m.issued)
+}
+
+/*
+Replaces a rejected token. stale is the token the caller sent; if it was already
+replaced, the current token is returned. Otherwise one fetch runs and every
+concurrent caller waits for its result.
+*/
+func (m *TokenManager) Refresh(stale string) (string, error) {
+	m.mu.Lock()
+	if m.token != "" && m.token != stale {
+		token := m.token
+		m.mu.Unlock()
+		return token, nil
+	}
+	if call := m.inFlight; call != nil {
+		m.mu.Unlock()
+		<-call.done
+		return call.token, call.err
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	m.inFlight = call
+	m.mu.Unlock()
+
+	call.token, call.err = m.fetch()
+	if call.err == nil && call.token == "" {
+		call.err = errors.New("no X-CSRF token returned")
+	}
+
+	m.mu.Lock()
+	if call.err == nil {
+		m.token, m.issued = call.token, time.Now()
+	}
+	m.inFlight = nil
+	m.mu.Unlock()
+	close(call.done)
+	return call.token, call.err
+}
+
+// Refreshes the token if there is none or it is older than maxAge
+func (m *TokenManager) EnsureFresh(maxAge time.Duration) (string, error) {
+	m.mu.Lock()
+	token, issued := m.token, m.issued
+	m.mu.Unlock()
+	if token != "" && time.Since(issued) < maxAge {
+		return token, nil
+	}
+	return m.Refresh(token)
+}
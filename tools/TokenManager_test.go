@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenManagerConcurrentRefresh(t *testing.T) {
+	const callers = 32
+	for _, name := range []string{"Refresh", "EnsureFresh"} {
+		t.Run(name, func(t *testing.T) {
+			var fetches atomic.Int32
+			release := make(chan struct{})
+			m := NewTokenManager(func() (string, error) {
+				<-release //Hold the fetch open so callers pile up behind it
+				return "token-" + string(rune('0'+fetches.Add(1))), nil
+			})
+			if age := m.Age(); age != 0 {
+				t.Errorf("age before the first fetch = %v, want 0", age)
+			}
+
+			start := time.Now()
+			tokens := make([]string, callers)
+			errs := make([]error, callers)
+			var started, done sync.WaitGroup
+			started.Add(callers)
+			done.Add(callers)
+			for i := range callers {
+				go func() {
+					defer done.Done()
+					started.Done()
+					if name == "Refresh" {
+						tokens[i], errs[i] = m.Refresh("")
+					} else {
+						tokens[i], errs[i] = m.EnsureFresh(time.Hour)
+					}
+				}()
+			}
+			started.Wait()
+			close(release)
+			done.Wait()
+
+			if n := fetches.Load(); n != 1 {
+				t.Errorf("%d fetches, want 1", n)
+			}
+			for i := range callers {
+				if errs[i] != nil || tokens[i] != "token-1" {
+					t.Errorf("caller %d got %q, %v", i, tokens[i], errs[i])
+				}
+			}
+			if got := m.Token(); got != "token-1" {
+				t.Errorf("token = %q, want token-1", got)
+			}
+			if age := m.Age(); age <= 0 || age > time.Since(start) {
+				t.Errorf("age = %v, want within the %v since the fetch started", age, time.Since(start))
+			}
+			time.Sleep(10 * time.Millisecond)
+			if age := m.Age(); age < 10*time.Millisecond {
+				t.Errorf("age = %v after waiting 10ms", age)
+			}
+		})
+	}
+}
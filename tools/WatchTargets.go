@@ -0,0 +1,106 @@
+package tools
+
+/*
+Alert targets for watch mode, keyed by asset id or acronym. Every condition set on an
+item is checked on its own and raises its own alert.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Conditions for a single item (nil fields are not checked)
+type WatchTarget struct {
+	BelowPrice *int     `yaml:"below_price"` //Alert at or below this price
+	BelowRAP   *float64 `yaml:"below_rap"`   //Alert at least this fraction below RAP, e.g. 0.2
+	BelowValue *float64 `yaml:"below_value"` //Alert at least this fraction below value (valued items only)
+	ZBelow     *float64 `yaml:"z_below"`     //Alert when the price z-score is at or below this
+	DipWithin  *int     `yaml:"dip_within"`  //Alert when the forecast has a dip within this many days
+}
+
+// Parsed targets file
+type WatchTargets struct {
+	ResellerInterval int                    `yaml:"reseller_interval"` //Seconds between reseller checks of every item (0 = deals feed only)
+	Cooldown         int                    `yaml:"cooldown"`          //Seconds before the same alert is raised again
+	Targets          map[string]WatchTarget `yaml:"targets"`
+}
+
+// Parses and validates watch targets, naming the first bad entry
+func ParseWatchTargets(data []byte) (*WatchTargets, error) {
+	w := &WatchTargets{Cooldown: 3600}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(w); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if w.ResellerInterval < 0 {
+		return nil, fmt.Errorf("reseller_interval %d must not be negative", w.ResellerInterval)
+	}
+	if w.Cooldown < 0 {
+		return nil, fmt.Errorf("cooldown %d must not be negative", w.Cooldown)
+	}
+	if len(w.Targets) == 0 {
+		return nil, errors.New("no targets")
+	}
+
+	//Normalize keys (acronyms are case-insensitive)
+	targets := make(map[string]WatchTarget, len(w.Targets))
+	for key, target := range w.Targets {
+		norm := normalizeItemKey(key)
+		if norm == "" {
+			return nil, errors.New("targets: empty item key")
+		}
+		if _, dup := targets[norm]; dup {
+			return nil, fmt.Errorf("target %q: listed twice", key)
+		}
+		if target.BelowPrice == nil && target.BelowRAP == nil && target.BelowValue == nil && target.ZBelow == nil && target.DipWithin == nil {
+			return nil, fmt.Errorf("target %q: no conditions", key)
+		}
+		if target.BelowPrice != nil && *target.BelowPrice <= 0 {
+			return nil, fmt.Errorf("target %q: below_price %d must be positive", key, *target.BelowPrice)
+		}
+		if target.BelowRAP != nil && !(0 < *target.BelowRAP && *target.BelowRAP < 1) {
+			return nil, fmt.Errorf("target %q: below_rap %v not in (0, 1)", key, *target.BelowRAP)
+		}
+		if target.BelowValue != nil && !(0 < *target.BelowValue && *target.BelowValue < 1) {
+			return nil, fmt.Errorf("target %q: below_value %v not in (0, 1)", key, *target.BelowValue)
+		}
+		if target.DipWithin != nil && *target.DipWithin < 0 {
+			return nil, fmt.Errorf("target %q: dip_within %d must not be negative", key, *target.DipWithin)
+		}
+		targets[norm] = target
+	}
+	w.Targets = targets
+	return w, nil
+}
+
+// Loads watch targets from a file
+func LoadWatchTargets(path string) (*WatchTargets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := ParseWatchTargets(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return w, nil
+}
+
+// Finds the target of an item by id, then acronym
+func (w *WatchTargets) Lookup(id string, acronym string) (WatchTarget, bool) {
+	if target, ok := w.Targets[normalizeItemKey(id)]; ok {
+		return target, true
+	}
+	if acronym == "" {
+		return WatchTarget{}, false
+	}
+	target, ok := w.Targets[normalizeItemKey(acronym)]
+	return target, ok
+}
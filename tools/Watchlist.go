@@ -0,0 +1,188 @@
+package tools
+
+/*
+Per-item watchlist and blocklist keyed by asset id or acronym, with overrides for
+margin, max price, max lots and an enabled flag. The file is re-read whenever it
+changes; a bad edit or a deleted file is rejected and the previous list stays in effect.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Overrides for a single item (nil fields fall back to global settings)
+type ItemRule struct {
+	Enabled  *bool    `yaml:"enabled"`   //false blocks the item
+	Margin   *float64 `yaml:"margin"`    //Margin below RAP/Value to buy
+	MaxPrice *int     `yaml:"max_price"` //Highest price to pay
+	MaxLots  *int     `yaml:"max_lots"`  //Most copies to hold at once
+}
+
+// Parsed watchlist file
+type Watchlist struct {
+	WatchOnly bool                `yaml:"watch_only"` //Only consider items on the watchlist
+	Items     map[string]ItemRule `yaml:"watchlist"`
+	Blocklist []string            `yaml:"blocklist"`
+
+	blocked map[string]bool
+}
+
+// Parses and validates a watchlist, naming the first bad entry
+func ParseWatchlist(data []byte) (*Watchlist, error) {
+	w := &Watchlist{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(w); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	//Normalize keys (acronyms are case-insensitive)
+	items := make(map[string]ItemRule, len(w.Items))
+	for key, rule := range w.Items {
+		norm := normalizeItemKey(key)
+		if norm == "" {
+			return nil, errors.New("watchlist: empty item key")
+		}
+		if _, dup := items[norm]; dup {
+			return nil, fmt.Errorf("watchlist %q: listed twice", key)
+		}
+		if rule.Margin != nil && !(0 < *rule.Margin && *rule.Margin < 1) {
+			return nil, fmt.Errorf("watchlist %q: margin %v not in (0, 1)", key, *rule.Margin)
+		}
+		if rule.MaxPrice != nil && *rule.MaxPrice <= 0 {
+			return nil, fmt.Errorf("watchlist %q: max_price %d must be positive", key, *rule.MaxPrice)
+		}
+		if rule.MaxLots != nil && *rule.MaxLots < 0 {
+			return nil, fmt.Errorf("watchlist %q: max_lots %d must not be negative", key, *rule.MaxLots)
+		}
+		items[norm] = rule
+	}
+	w.Items = items
+
+	w.blocked = make(map[string]bool, len(w.Blocklist))
+	for _, key := range w.Blocklist {
+		norm := normalizeItemKey(key)
+		if norm == "" {
+			return nil, errors.New("blocklist: empty item key")
+		}
+		if _, listed := w.Items[norm]; listed {
+			return nil, fmt.Errorf("blocklist %q: also on watchlist", key)
+		}
+		w.blocked[norm] = true
+	}
+	return w, nil
+}
+
+// Finds the rule for an item by id, then acronym; allowed is false for blocked or unlisted (watch-only) items
+func (w *Watchlist) Lookup(id string, acronym string) (rule ItemRule, allowed bool) {
+	if w == nil {
+		return rule, true
+	}
+	keys := []string{normalizeItemKey(id)}
+	if acronym != "" {
+		keys = append(keys, normalizeItemKey(acronym))
+	}
+
+	listed := false
+	for _, key := range keys {
+		if w.blocked[key] {
+			return rule, false
+		}
+		if r, ok := w.Items[key]; ok && !listed {
+			rule, listed = r, true
+		}
+	}
+	if rule.Enabled != nil && !*rule.Enabled {
+		return rule, false
+	}
+	return rule, listed || !w.WatchOnly
+}
+
+func normalizeItemKey(key string) string {
+	return strings.ToUpper(strings.TrimSpace(key))
+}
+
+// Watchlist file that reloads itself when modified
+type WatchlistFile struct {
+	path    string
+	mu      sync.RWMutex
+	current *Watchlist
+	modTime time.Time
+	size    int64
+	missing bool //Missing file already reported
+}
+
+// Loads watchlist file; a missing file means no watchlist (every item allowed)
+func LoadWatchlist(path string) (*WatchlistFile, error) {
+	wf := &WatchlistFile{path: path}
+	if _, err := wf.Reload(); err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+// Re-reads the file if it changed since the last load; keeps the previous list on error
+func (wf *WatchlistFile) Reload() (bool, error) {
+	if wf == nil || wf.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(wf.path)
+	if errors.Is(err, os.ErrNotExist) {
+		//Never drop a loaded blocklist because the file went away
+		wf.mu.Lock()
+		defer wf.mu.Unlock()
+		if wf.current == nil || wf.missing {
+			return false, nil
+		}
+		wf.missing = true
+		wf.modTime, wf.size = time.Time{}, 0 //Reload once it is back
+		return false, fmt.Errorf("%s: file missing (keeping previous list)", wf.path)
+	}
+	if err != nil {
+		return false, err
+	}
+	wf.mu.Lock()
+	wf.missing = false
+	wf.mu.Unlock()
+
+	wf.mu.RLock()
+	unchanged := info.ModTime().Equal(wf.modTime) && info.Size() == wf.size
+	wf.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(wf.path)
+	if err != nil {
+		return false, err
+	}
+	list, err := ParseWatchlist(data)
+
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	wf.modTime, wf.size = info.ModTime(), info.Size() //Don't retry a bad edit every poll
+	if err != nil {
+		return false, fmt.Errorf("%s: %w (keeping previous list)", wf.path, err)
+	}
+	wf.current = list
+	return true, nil
+}
+
+// Currently active watchlist (nil if none)
+func (wf *WatchlistFile) Current() *Watchlist {
+	if wf == nil {
+		return nil
+	}
+	wf.mu.RLock()
+	defer wf.mu.RUnlock()
+	return wf.current
+}
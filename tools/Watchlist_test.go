@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchlistLookup(t *testing.T) {
+	w, err := ParseWatchlist([]byte(`
+watchlist:
+  "100":
+    max_lots: 2
+  "dtf":
+    enabled: false
+blocklist:
+  - "200"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id, acronym string
+		allowed     bool
+	}{
+		{"100", "", true},
+		{"300", "DTF", false},
+		{"200", "", false},
+		{"400", "", true},
+	}
+	for _, tt := range tests {
+		if _, allowed := w.Lookup(tt.id, tt.acronym); allowed != tt.allowed {
+			t.Errorf("Lookup(%s, %s) allowed = %v, want %v", tt.id, tt.acronym, allowed, tt.allowed)
+		}
+	}
+	if rule, _ := w.Lookup("100", ""); rule.MaxLots == nil || *rule.MaxLots != 2 {
+		t.Errorf("max_lots of 100 = %v, want 2", rule.MaxLots)
+	}
+}
+
+func TestWatchlistReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchlist.yaml")
+
+	//No file at startup: nothing blocked
+	wf, err := LoadWatchlist(path)
+	if err != nil || wf.Current() != nil {
+		t.Fatalf("missing file: %v, %v", wf.Current(), err)
+	}
+
+	os.WriteFile(path, []byte("blocklist: [\"200\"]\n"), 0644)
+	if changed, err := wf.Reload(); !changed || err != nil {
+		t.Fatalf("created file: changed %v, %v", changed, err)
+	}
+
+	//Deleting the file keeps the blocklist, reported once
+	os.Remove(path)
+	if _, err := wf.Reload(); err == nil {
+		t.Error("deleted file not reported")
+	}
+	if _, err := wf.Reload(); err != nil {
+		t.Errorf("deleted file reported again: %v", err)
+	}
+	if _, allowed := wf.Current().Lookup("200", ""); allowed {
+		t.Error("blocklist dropped with the file")
+	}
+
+	//An empty file lifts it
+	os.WriteFile(path, nil, 0644)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	if changed, err := wf.Reload(); !changed || err != nil {
+		t.Fatalf("emptied file: changed %v, %v", changed, err)
+	}
+	if _, allowed := wf.Current().Lookup("200", ""); !allowed {
+		t.Error("blocklist kept after emptying the file")
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"robolimited/notify"
+	"robolimited/tools"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+Watch mode: alerts when listed items meet their targets (price, margin below RAP or
+value, z-score, forecast dip window). Reads the deals feed and reseller listings
+only; no session check, order or purchase code runs.
+*/
+
+// One watched item with its latest market data
+type watchedItem struct {
+	id     string
+	name   string
+	target tools.WatchTarget
+	rap    int
+	value  int   //-1 if the item has no value
+	price  int   //Latest best price seen (0 if none yet)
+	dips   []int //Forecast dips in days from now
+}
+
+type watcher struct {
+	targets    *tools.WatchTargets
+	items      map[string]*watchedItem
+	daysPast   int64
+	daysFuture int64
+	alerted    map[string]time.Time //id|condition -> last alert
+}
+
+// Watches the items in targetsFile until interrupted; fails if no target resolves to an item
+func watch(targetsFile string, daysPast int64, daysFuture int64) error {
+	targets, err := tools.LoadWatchTargets(targetsFile)
+	if err != nil {
+		return fmt.Errorf("could not load watch targets: %w", err)
+	}
+	w := &watcher{
+		targets:    targets,
+		items:      make(map[string]*watchedItem),
+		daysPast:   daysPast,
+		daysFuture: daysFuture,
+		alerted:    make(map[string]time.Time),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tracker := tools.NewActivityTracker(time.Duration(settings.ActivityTTL) * time.Second)
+	resellerInterval := time.Duration(targets.ResellerInterval) * time.Second
+	var lastResellers time.Time
+
+	if !w.refresh() {
+		return errors.New("could not load item details to resolve watch targets")
+	}
+	if len(w.items) == 0 {
+		return fmt.Errorf("no watch target in %s matches an item", targetsFile)
+	}
+
+	fmt.Println("Watching", len(targets.Targets), "targets from", targetsFile)
+	notifier.Notify(notify.Monitor(notify.Info, "started", "watching "+strconv.Itoa(len(targets.Targets))+" targets"))
+
+	for i := range settings.TotalIterations {
+		if !throttleMonitor(ctx) {
+			break
+		}
+
+		if i > 0 && i%settings.RefreshRate == 0 {
+			w.refresh()
+		}
+
+		if resellerInterval > 0 && time.Since(lastResellers) >= resellerInterval {
+			w.checkResellers(ctx)
+			lastResellers = time.Now()
+		}
+
+		//[[timestamp, isRAP, id, bestPrice / RAP]]
+		dealDetails := tools.GetDealsData()
+		if dealDetails == nil {
+			continue
+		}
+		activities, _ := tracker.Track(dealDetails.Activities, time.Now())
+		for _, activity := range activities {
+			item := w.items[activity.ID]
+			if item == nil {
+				continue
+			}
+			if activity.IsRAP {
+				item.rap = activity.Price
+				continue
+			}
+			w.check(item, activity.Price, "deals")
+		}
+	}
+
+	notifier.Notify(notify.Monitor(notify.Info, "stopped", "watch mode"))
+	return nil
+}
+
+// Resolves targets to items, reloads RAP / value and recomputes forecast dips (false if item details are unavailable)
+func (w *watcher) refresh() bool {
+	//id -> [item_name, acronym, rap, value, default_value, demand, trend, projected, hyped, rare]
+	itemDetails := tools.GetLimitedData()
+	if itemDetails == nil {
+		log.Println("Could not refresh item details..")
+		return false
+	}
+
+	matched := make(map[string]bool)
+	for id, details := range itemDetails.Items {
+		if len(details) < 4 {
+			continue
+		}
+		acronym, _ := details[1].(string)
+		target, ok := w.targets.Lookup(id, acronym)
+		if !ok {
+			continue
+		}
+		matched[strings.ToUpper(id)] = true
+		if acronym != "" {
+			matched[strings.ToUpper(acronym)] = true
+		}
+
+		item := w.items[id]
+		if item == nil {
+			item = &watchedItem{id: id, target: target}
+			w.items[id] = item
+		}
+		item.name, _ = details[0].(string)
+		rap, _ := details[2].(float64)
+		value, _ := details[3].(float64)
+		item.rap, item.value = int(rap), int(value)
+
+		if target.DipWithin != nil {
+			_, _, _, item.dips, _, _ = modelFourierSTL(id, w.daysPast, w.daysFuture, false)
+			w.checkDips(item)
+		}
+	}
+
+	for key := range w.targets.Targets {
+		if !matched[key] {
+			log.Println("Watch target", key, "matches no item")
+		}
+	}
+	return true
+}
+
+// Checks the lowest reseller listing of every watched item
+func (w *watcher) checkResellers(ctx context.Context) {
+	for _, item := range w.items {
+		if ctx.Err() != nil {
+			return
+		}
+		collectibleItemId, err := tools.GetCollectibleId(item.id)
+		if err != nil {
+			log.Println("Could not resolve collectible id of", item.name, ":", err)
+			continue
+		}
+		sellers, err := tools.GetResellers(collectibleItemId)
+		if err != nil {
+			log.Println("Could not get resellers of", item.name, ":", err)
+			continue
+		}
+		lowest := 0
+		for _, seller := range sellers {
+			if seller.Price > 0 && (lowest == 0 || seller.Price < lowest) {
+				lowest = seller.Price
+			}
+		}
+		if lowest > 0 {
+			w.check(item, lowest, "resellers")
+		}
+	}
+}
+
+// Raises an alert for every price condition the item meets
+func (w *watcher) check(item *watchedItem, price int, source string) {
+	item.price = price
+	target := item.target
+	if target.BelowPrice != nil && price <= *target.BelowPrice {
+		w.alert(item, "below_price", fmt.Sprintf("price %d <= %d (%s)", price, *target.BelowPrice, source))
+	}
+	if target.BelowRAP != nil && item.rap > 0 && float64(price) <= float64(item.rap)*(1-*target.BelowRAP) {
+		w.alert(item, "below_rap", fmt.Sprintf("price %d is %.1f%% below RAP %d (%s)", price, discount(price, item.rap), item.rap, source))
+	}
+	if target.BelowValue != nil && item.value > 0 && float64(price) <= float64(item.value)*(1-*target.BelowValue) {
+		w.alert(item, "below_value", fmt.Sprintf("price %d is %.1f%% below value %d (%s)", price, discount(price, item.value), item.value, source))
+	}
+	if target.ZBelow != nil {
+		z := findZScore(item.id, float64(price), false)
+		if !math.IsNaN(z) && !math.IsInf(z, 0) && z <= *target.ZBelow {
+			w.alert(item, "z_below", fmt.Sprintf("price %d has z-score %.2f <= %.2f (%s)", price, z, *target.ZBelow, source))
+		}
+	}
+}
+
+// Raises an alert if the forecast has a dip within the target window
+func (w *watcher) checkDips(item *watchedItem) {
+	for _, day := range item.dips {
+		if 0 <= day && day <= *item.target.DipWithin {
+			w.alert(item, "dip_within", fmt.Sprintf("forecast dip in %d days (window %d)", day, *item.target.DipWithin))
+			return
+		}
+	}
+}
+
+// Percent of price below a reference
+func discount(price int, reference int) float64 {
+	return float64(reference-price) / float64(reference) * 100
+}
+
+// Prints, logs and notifies an alert unless the same one fired within the cooldown
+func (w *watcher) alert(item *watchedItem, condition string, detail string) {
+	key := item.id + "|" + condition
+	cooldown := time.Duration(w.targets.Cooldown) * time.Second
+	if last, ok := w.alerted[key]; ok && time.Since(last) < cooldown {
+		return
+	}
+	w.alerted[key] = time.Now()
+
+	price := item.price
+	if price == 0 {
+		price = item.rap
+	}
+	line := "ALERT " + item.name + " (" + item.id + ") | " + condition + " | " + detail
+	fmt.Println(line)
+	tools.WriteLineToFile(settings.ConsoleLogFile, line)
+	notifier.Notify(notify.Alert(item.id, item.name, price, condition, detail))
+}